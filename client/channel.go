@@ -1,6 +1,7 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"github.com/dermesser/clusterrpc/log"
 	smgr "github.com/dermesser/clusterrpc/securitymanager"
@@ -68,12 +69,17 @@ type RpcChannel struct {
 
 	// Slices to allow multiple connections (round-robin)
 	peers []PeerAddress
+
+	// For additional sockets, e.g. for streams
+	security_manager *smgr.ClientSecurityManager
+	options          ChannelOptions
+	next_peer        int
 }
 
 // Create a new RpcChannel.
-// security_manager may be nil.
-func NewRpcChannel(security_manager *smgr.ClientSecurityManager) (*RpcChannel, error) {
-	channel := RpcChannel{}
+// security_manager may be nil. Socket settings are passed as opts (see ChannelOptions).
+func NewRpcChannel(security_manager *smgr.ClientSecurityManager, opts ...ChannelOption) (*RpcChannel, error) {
+	channel := RpcChannel{security_manager: security_manager, options: makeChannelOptions(opts)}
 
 	var err error
 	channel.channel, err = zmq.NewSocket(zmq.REQ)
@@ -92,13 +98,16 @@ func NewRpcChannel(security_manager *smgr.ClientSecurityManager) (*RpcChannel, e
 		}
 	}
 
-	channel.channel.SetIpv6(true)
+	err = channel.options.apply(channel.channel)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when applying socket options:", err.Error())
+		channel.channel.Close()
+		return nil, err
+	}
+
 	channel.channel.SetLinger(0)
-	channel.channel.SetReconnectIvl(100 * time.Millisecond)
 	channel.channel.SetImmediate(true)
-
-	channel.channel.SetSndtimeo(10 * time.Second)
-	channel.channel.SetRcvtimeo(10 * time.Second)
 	channel.channel.SetReqRelaxed(1)
 	channel.channel.SetReqCorrelate(1)
 
@@ -106,8 +115,8 @@ func NewRpcChannel(security_manager *smgr.ClientSecurityManager) (*RpcChannel, e
 }
 
 // NewChannelAndConnect creates a new channel and connects it to `addr`.
-func NewChannelAndConnect(addr PeerAddress, security_manager *smgr.ClientSecurityManager) (*RpcChannel, error) {
-	channel, err := NewRpcChannel(security_manager)
+func NewChannelAndConnect(addr PeerAddress, security_manager *smgr.ClientSecurityManager, opts ...ChannelOption) (*RpcChannel, error) {
+	channel, err := NewRpcChannel(security_manager, opts...)
 
 	if err != nil {
 		return nil, err
@@ -155,10 +164,53 @@ func (c *RpcChannel) Reconnect() {
 	}
 }
 
-// Set send/receive timeout on this channel.
+// Set send/receive timeout on this channel. 0 means no timeout.
 func (c *RpcChannel) SetTimeout(d time.Duration) {
-	c.channel.SetSndtimeo(d)
-	c.channel.SetRcvtimeo(d)
+	c.options.Timeout = d
+	c.channel.SetSndtimeo(zmqTimeout(d))
+	c.channel.SetRcvtimeo(zmqTimeout(d))
+}
+
+// Creates a DEALER socket connected to one of the peers (round-robin), used for streams.
+// Stream messages must all go to the same server, so it's never connected to more than one peer.
+func (c *RpcChannel) newStreamSocket() (*zmq.Socket, error) {
+	if len(c.peers) == 0 {
+		return nil, errors.New("Channel is not connected")
+	}
+
+	sock, err := zmq.NewSocket(zmq.DEALER)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when creating stream socket:", err.Error())
+		return nil, err
+	}
+
+	err = c.security_manager.ApplyToClientSocket(sock)
+
+	if err != nil {
+		sock.Close()
+		return nil, err
+	}
+
+	err = c.options.apply(sock)
+
+	if err != nil {
+		sock.Close()
+		return nil, err
+	}
+	sock.SetLinger(0)
+
+	peer := c.peers[c.next_peer%len(c.peers)]
+	c.next_peer++
+
+	err = sock.Connect(peer.ToUrl())
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not connect stream socket to", peer.String(), ":", err.Error())
+		sock.Close()
+		return nil, err
+	}
+	return sock, nil
 }
 
 func (c *RpcChannel) destroy() {
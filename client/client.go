@@ -3,6 +3,7 @@ package client
 import (
 	"github.com/dermesser/clusterrpc/proto"
 	golog "log"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/gogo/protobuf/proto"
@@ -10,6 +11,9 @@ import (
 
 // A client contains a channel and some metadata, a state machine, and a stack of client filters.
 type Client struct {
+	// One-way requests that could not be delivered. Accessed atomically; first field for alignment.
+	oneway_failures uint64
+
 	channel RpcChannel
 	name    string
 
@@ -25,6 +29,9 @@ type Client struct {
 	rpclogger *golog.Logger
 
 	filters []ClientFilter
+
+	// Codecs the server responded STATUS_UNSUPPORTED_COMPRESSION to
+	unsupported_compression map[string]bool
 }
 
 // NewClient is deprecated; use New()
@@ -37,7 +44,8 @@ func NewClient(name string, channel *RpcChannel) Client {
 func New(name string, channel *RpcChannel) Client {
 	rqa := make(chan bool, 1)
 	rqa <- true
-	return Client{name: name, channel: *channel, active: true, request_active: rqa, defaultParams: *NewParams(), filters: default_filters}
+	return Client{name: name, channel: *channel, active: true, request_active: rqa, defaultParams: *NewParams(), filters: default_filters,
+		unsupported_compression: make(map[string]bool)}
 }
 
 // Set socket timeout (default 10s) and whether to propagate this timeout through the call tree.
@@ -64,6 +72,15 @@ func (client *Client) NewRequest(service, endpoint string) *Request {
 	return &Request{client: client, params: client.defaultParams, service: service, endpoint: endpoint}
 }
 
+/*
+Returns the number of one-way requests (see Request.SetOneWay()) that could not be sent. This
+is a best-effort count: requests that were sent but then dropped (e.g. by a server that sheds
+load, or because their deadline passed) are not counted, as nobody tells the client about them.
+*/
+func (client *Client) OneWayFailures() uint64 {
+	return atomic.LoadUint64(&client.oneway_failures)
+}
+
 // Sends a request to the server, asking whether it accepts requests and
 // testing general connectivity. Uses a timeout of 1 second.
 func (client *Client) IsHealthy() bool {
@@ -78,7 +78,8 @@ func (cc *ConnectionCache) Return(clp **Client) {
 
 	if !ok {
 		// Happens when there was a garbage collection (CleanOld()) in between
-		cc.cache[(*clp).channel.peers[0].String()] = list.New()
+		cls = list.New()
+		cc.cache[(*clp).channel.peers[0].String()] = cls
 	}
 
 	cls.PushBack(cl)
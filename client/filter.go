@@ -1,7 +1,9 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"github.com/dermesser/clusterrpc/compression"
 	"github.com/dermesser/clusterrpc/log"
 	"github.com/dermesser/clusterrpc/proto"
 	"time"
@@ -13,7 +15,7 @@ import (
 type ClientFilter (func(rq *Request, next_filter int) Response)
 
 // TODO: Add RedirectFilter
-var default_filters = []ClientFilter{TraceMergeFilter, TimeoutFilter, RetryFilter, DebugFilter, SendFilter}
+var default_filters = []ClientFilter{TraceMergeFilter, TimeoutFilter, RetryFilter, DebugFilter, CompressionFilter, SendFilter}
 
 // Appends the received trace info to context or requested trace.
 func TraceMergeFilter(rq *Request, next int) Response {
@@ -34,6 +36,10 @@ func TraceMergeFilter(rq *Request, next int) Response {
 func TimeoutFilter(rq *Request, next int) Response {
 	old_timeout, err := rq.client.channel.channel.GetRcvtimeo()
 
+	if rq.ctx != nil && !rq.ctx.GetDeadline().IsZero() && !time.Now().Before(rq.ctx.GetDeadline()) {
+		return Response{err: errors.New("Deadline of calling context has passed")}
+	}
+
 	if err == nil {
 		if rq.ctx != nil && !rq.ctx.GetDeadline().IsZero() {
 			rq.client.channel.SetTimeout(rq.ctx.GetDeadline().Sub(time.Now()))
@@ -95,6 +101,55 @@ func DebugFilter(rq *Request, next int) Response {
 	return rq.callNextFilter(next)
 }
 
+/*
+Compresses the request payload according to the request parameters, and decompresses the
+response. If the server doesn't support the codec, the request is sent again uncompressed,
+and the codec is not used anymore by this client.
+*/
+func CompressionFilter(rq *Request, next int) Response {
+	codec := compression.Get(rq.params.compression)
+
+	if codec == nil || len(rq.payload) < rq.params.compression_threshold ||
+		rq.client.unsupported_compression[codec.Name()] {
+		return decompressResponse(rq.callNextFilter(next))
+	}
+
+	compressed, err := codec.Compress(rq.payload)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Could not compress request", rq.rpcid, ", sending it uncompressed:", err.Error())
+		return decompressResponse(rq.callNextFilter(next))
+	}
+
+	payload := rq.payload
+	rq.payload, rq.compression = compressed, codec.Name()
+	response := rq.callNextFilter(next)
+	rq.payload, rq.compression = payload, ""
+
+	if response.response != nil && response.response.GetResponseStatus() == proto.RPCResponse_STATUS_UNSUPPORTED_COMPRESSION {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Server doesn't support compression", codec.Name(), "; sending uncompressed requests")
+		rq.client.unsupported_compression[codec.Name()] = true
+		response = rq.callNextFilter(next)
+	}
+	return decompressResponse(response)
+}
+
+func decompressResponse(response Response) Response {
+	if response.response == nil || response.response.GetCompression() == "" {
+		return response
+	}
+
+	data, err := compression.Decompress(response.response.GetCompression(), response.response.GetResponseData())
+
+	if err != nil {
+		return Response{err: err}
+	}
+
+	response.response.ResponseData = data
+	response.response.Compression = nil
+	return response
+}
+
 // Send a request and wait for it to complete. Must be the last filter in the stack
 func SendFilter(rq *Request, next int) Response {
 	// Enforce that this is the last filter.
@@ -116,6 +171,11 @@ func SendFilter(rq *Request, next int) Response {
 		return Response{err: err}
 	}
 
+	// No response will come; REQ_RELAXED allows sending the next request anyway.
+	if rq.one_way {
+		return Response{response: &proto.RPCResponse{RpcId: message.RpcId, ResponseStatus: proto.RPCResponse_STATUS_OK.Enum()}}
+	}
+
 	response_payload, err := rq.client.channel.receiveMessage()
 
 	if err != nil {
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"time"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+/*
+Tuning of the sockets of a channel. Zero values mean the ZeroMQ default, except where noted.
+Pass ChannelOption functions to NewRpcChannel(); DefaultChannelOptions() has the settings
+used if none are given.
+*/
+type ChannelOptions struct {
+	// Send/receive timeout (0 = no timeout; see also RpcChannel.SetTimeout())
+	Timeout time.Duration
+	// Maximum number of messages queued per connection, per direction
+	SendHWM, ReceiveHWM int
+	// Initial interval between reconnection attempts; it is doubled after every failed
+	// attempt up to ReconnectIntervalMax (0 = no backoff)
+	ReconnectInterval, ReconnectIntervalMax time.Duration
+	// Enable TCP keepalive; idle time before the first probe and time between probes
+	TCPKeepalive                           bool
+	TCPKeepaliveIdle, TCPKeepaliveInterval time.Duration
+	// ZMTP heartbeats: A PING is sent every HeartbeatInterval; a server that doesn't respond
+	// within HeartbeatTimeout is considered dead and the connection is reestablished.
+	// Requires ZeroMQ 4.2.
+	HeartbeatInterval, HeartbeatTimeout time.Duration
+	// Responses larger than this are refused
+	MaxMessageSize int64
+	// Connect to IPv6 addresses (default true)
+	IPv6 bool
+}
+
+type ChannelOption func(*ChannelOptions)
+
+func DefaultChannelOptions() ChannelOptions {
+	return ChannelOptions{Timeout: 10 * time.Second, ReconnectInterval: 100 * time.Millisecond, IPv6: true}
+}
+
+// Set the send/receive timeout of the channel.
+func SocketTimeout(d time.Duration) ChannelOption {
+	return func(o *ChannelOptions) {
+		o.Timeout = d
+	}
+}
+
+// Set the high-water marks for sending and receiving, in messages per connection.
+func HWM(send, receive int) ChannelOption {
+	return func(o *ChannelOptions) {
+		o.SendHWM, o.ReceiveHWM = send, receive
+	}
+}
+
+// Set the reconnection interval and the maximum it backs off to.
+func ReconnectBackoff(initial, max time.Duration) ChannelOption {
+	return func(o *ChannelOptions) {
+		o.ReconnectInterval, o.ReconnectIntervalMax = initial, max
+	}
+}
+
+// Enable TCP keepalive, sending probes after idle and then every interval (0 = system default).
+// Both are rounded up to whole seconds.
+func TCPKeepalive(idle, interval time.Duration) ChannelOption {
+	return func(o *ChannelOptions) {
+		o.TCPKeepalive = true
+		o.TCPKeepaliveIdle, o.TCPKeepaliveInterval = idle, interval
+	}
+}
+
+// Enable ZMTP heartbeats for detecting dead servers.
+func Heartbeat(interval, timeout time.Duration) ChannelOption {
+	return func(o *ChannelOptions) {
+		o.HeartbeatInterval, o.HeartbeatTimeout = interval, timeout
+	}
+}
+
+// Refuse messages larger than n bytes.
+func MaxMessageSize(n int64) ChannelOption {
+	return func(o *ChannelOptions) {
+		o.MaxMessageSize = n
+	}
+}
+
+// Enable or disable IPv6.
+func IPv6(enable bool) ChannelOption {
+	return func(o *ChannelOptions) {
+		o.IPv6 = enable
+	}
+}
+
+func makeChannelOptions(opts []ChannelOption) ChannelOptions {
+	o := DefaultChannelOptions()
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Apply the options to a socket. Must be called before connecting it. Returns the first error.
+func (o *ChannelOptions) apply(sock *zmq.Socket) error {
+	var err error
+	set := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+
+	set(sock.SetIpv6(o.IPv6))
+	set(sock.SetSndtimeo(zmqTimeout(o.Timeout)))
+	set(sock.SetRcvtimeo(zmqTimeout(o.Timeout)))
+
+	if o.ReconnectInterval > 0 {
+		set(sock.SetReconnectIvl(o.ReconnectInterval))
+	}
+	if o.ReconnectIntervalMax > 0 {
+		set(sock.SetReconnectIvlMax(o.ReconnectIntervalMax))
+	}
+	if o.SendHWM > 0 {
+		set(sock.SetSndhwm(o.SendHWM))
+	}
+	if o.ReceiveHWM > 0 {
+		set(sock.SetRcvhwm(o.ReceiveHWM))
+	}
+	if o.TCPKeepalive {
+		set(sock.SetTcpKeepalive(1))
+
+		if o.TCPKeepaliveIdle > 0 {
+			set(sock.SetTcpKeepaliveIdle(keepaliveSeconds(o.TCPKeepaliveIdle)))
+		}
+		if o.TCPKeepaliveInterval > 0 {
+			set(sock.SetTcpKeepaliveIntvl(keepaliveSeconds(o.TCPKeepaliveInterval)))
+		}
+	}
+	if o.HeartbeatInterval > 0 {
+		set(sock.SetHeartbeatIvl(o.HeartbeatInterval))
+	}
+	if o.HeartbeatTimeout > 0 {
+		set(sock.SetHeartbeatTimeout(o.HeartbeatTimeout))
+	}
+	if o.MaxMessageSize > 0 {
+		set(sock.SetMaxmsgsize(o.MaxMessageSize))
+	}
+	return err
+}
+
+// The TCP keepalive options have a resolution of seconds; d is rounded up, so that sub-second
+// values don't turn into 0 (i.e. the system default).
+func keepaliveSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// ZeroMQ treats a timeout of 0 as "don't block"; here, 0 means the ZeroMQ default (-1, no timeout).
+func zmqTimeout(d time.Duration) time.Duration {
+	if d == 0 {
+		return -1
+	}
+	return d
+}
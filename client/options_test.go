@@ -0,0 +1,36 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChannelOptions(t *testing.T) {
+	o := makeChannelOptions([]ChannelOption{SocketTimeout(0), TCPKeepalive(500*time.Millisecond, 1500*time.Millisecond),
+		IPv6(false)})
+
+	if o.Timeout != 0 || !o.TCPKeepalive || o.IPv6 {
+		t.Fatal("options not applied:", o)
+	}
+	if d := makeChannelOptions(nil); d != DefaultChannelOptions() {
+		t.Fatal("unexpected defaults:", d)
+	}
+}
+
+func TestZmqTimeout(t *testing.T) {
+	if zmqTimeout(0) != -1 {
+		t.Error("0 not mapped to no timeout:", zmqTimeout(0))
+	}
+	if zmqTimeout(time.Second) != time.Second {
+		t.Error("timeout changed:", zmqTimeout(time.Second))
+	}
+}
+
+func TestKeepaliveSeconds(t *testing.T) {
+	for d, s := range map[time.Duration]int{time.Millisecond: 1, time.Second: 1, 1500 * time.Millisecond: 2,
+		time.Minute: 60} {
+		if keepaliveSeconds(d) != s {
+			t.Error("keepaliveSeconds", d, "=", keepaliveSeconds(d), "instead of", s)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package client
 
 import (
 	"errors"
+	"github.com/dermesser/clusterrpc/compression"
 	"github.com/dermesser/clusterrpc/log"
 	"github.com/dermesser/clusterrpc/proto"
 	"github.com/dermesser/clusterrpc/server"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/gogo/protobuf/proto"
@@ -12,14 +14,21 @@ import (
 
 // Various parameters determining how a request is executed. There are builder methods to set the various parameters.
 type RequestParams struct {
-	accept_redirect      bool
-	retries              uint
-	deadline_propagation bool
-	timeout              time.Duration
+	accept_redirect       bool
+	retries               uint
+	deadline_propagation  bool
+	timeout               time.Duration
+	stream_window         uint32
+	compression           string
+	compression_threshold int
+	forward_metadata      []string
+	priority              uint32
 }
 
 func NewParams() *RequestParams {
-	return &RequestParams{accept_redirect: true, retries: 0, deadline_propagation: false, timeout: 10 * time.Second}
+	return &RequestParams{accept_redirect: true, retries: 0, deadline_propagation: false, timeout: 10 * time.Second,
+		stream_window: server.DEFAULT_STREAM_WINDOW, compression_threshold: compression.DEFAULT_THRESHOLD,
+		priority: server.PRIORITY_NORMAL}
 }
 
 // Whether to follow redirects issued by the server. May impact efficiency.
@@ -34,7 +43,9 @@ func (p *RequestParams) Retries(r uint) *RequestParams {
 	return p
 }
 
-// Whether to enable deadline propagation; that is, tell the server the time beyond which it doesn't need to bother returning a response.
+// Whether to enable deadline propagation; that is, tell the server how long we wait for a response (the timeout), so it
+// doesn't need to bother with requests it can't answer in time. Requests with a context (see Request.SetContext()) that has
+// a deadline always propagate the time left until it.
 func (p *RequestParams) DeadlinePropagation(b bool) *RequestParams {
 	p.deadline_propagation = b
 	return p
@@ -46,6 +57,49 @@ func (p *RequestParams) Timeout(d time.Duration) *RequestParams {
 	return p
 }
 
+// How many responses of a stream (see GoStream()) may be buffered before the server has to wait. Default: 16
+func (p *RequestParams) StreamWindow(n uint32) *RequestParams {
+	if n == 0 {
+		n = 1
+	}
+	p.stream_window = n
+	return p
+}
+
+/*
+Compress request payloads with this codec (see package compression), and accept compressed
+responses. Payloads smaller than the threshold (see CompressionThreshold()) are sent
+uncompressed. If the server doesn't support the codec, requests are sent uncompressed.
+Default: "" (no compression)
+*/
+func (p *RequestParams) Compression(codec string) *RequestParams {
+	p.compression = codec
+	return p
+}
+
+// Minimum payload size (bytes) for compression. Default: compression.DEFAULT_THRESHOLD
+func (p *RequestParams) CompressionThreshold(n int) *RequestParams {
+	p.compression_threshold = n
+	return p
+}
+
+/*
+Copy the metadata entries with these keys from the context set with Request.SetContext() to
+the request, e.g. to propagate an auth token or tenant ID through the call tree. Entries set
+on the request itself take precedence.
+*/
+func (p *RequestParams) ForwardMetadata(keys ...string) *RequestParams {
+	p.forward_metadata = append(p.forward_metadata[:len(p.forward_metadata):len(p.forward_metadata)], keys...)
+	return p
+}
+
+// Priority of the request (server.PRIORITY_BATCH ... server.PRIORITY_CRITICAL). When the server
+// is busy, requests of higher priority are served first. Default: server.PRIORITY_NORMAL
+func (p *RequestParams) Priority(priority uint32) *RequestParams {
+	p.priority = priority
+	return p
+}
+
 // An RPC request that can be modified before it is sent.
 type Request struct {
 	client            *Client
@@ -57,6 +111,10 @@ type Request struct {
 
 	rpcid         string
 	attempt_count int
+	one_way       bool
+	// codec the payload is compressed with (set by CompressionFilter)
+	compression string
+	metadata    []*proto.KeyValue
 
 	// request payload
 	payload []byte
@@ -75,6 +133,30 @@ func (r *Request) SetTrace(t *proto.TraceInfo) *Request {
 	return r
 }
 
+/*
+A one-way request is only sent; the server runs the handler, but doesn't respond, and Go()
+returns as soon as the request has been sent. Ok() on the returned Response then only
+indicates that the request could be sent. Failures to send are counted by
+Client.OneWayFailures(); there is no way to learn whether the handler has run.
+*/
+func (r *Request) SetOneWay(one_way bool) *Request {
+	r.one_way = one_way
+	return r
+}
+
+// Send a metadata entry with the request; the handler obtains it using Context.GetMetadata().
+// An existing entry with the same key is replaced.
+func (r *Request) SetMetadata(key, value string) *Request {
+	for _, kv := range r.metadata {
+		if kv.GetKey() == key {
+			kv.Value = pb.String(value)
+			return r
+		}
+	}
+	r.metadata = append(r.metadata, &proto.KeyValue{Key: pb.String(key), Value: pb.String(value)})
+	return r
+}
+
 func (r *Request) callNextFilter(index int) Response {
 	if len(r.client.filters) < index+1 {
 		panic("Bad filter setup: Not enough filters.")
@@ -90,12 +172,50 @@ func (r *Request) makeRPCRequestProto() *proto.RPCRequest {
 	rq.Srvc = &r.service
 	rq.WantTrace = pb.Bool(r.trace != nil || (r.ctx != nil && r.ctx.GetTraceInfo() != nil))
 	rq.RpcId = &r.rpcid
-	if r.params.deadline_propagation {
-		rq.Deadline = pb.Int64((time.Now().UnixNano() + r.params.timeout.Nanoseconds()) / 1000)
+	if r.one_way {
+		rq.OneWay = pb.Bool(true)
+	}
+	if r.compression != "" {
+		rq.Compression = pb.String(r.compression)
+	}
+	if r.params.compression != "" {
+		rq.AcceptCompression = pb.String(r.params.compression)
+	}
+	if r.params.priority != server.PRIORITY_NORMAL {
+		rq.Priority = pb.Uint32(r.params.priority)
+	}
+
+	rq.Metadata = r.metadata[:len(r.metadata):len(r.metadata)]
+
+	if r.ctx != nil {
+		for _, key := range r.params.forward_metadata {
+			if value := r.ctx.GetMetadata(key); value != "" && !hasMetadata(r.metadata, key) {
+				rq.Metadata = append(rq.Metadata, &proto.KeyValue{Key: pb.String(key), Value: pb.String(value)})
+			}
+		}
+	}
+	if budget, ok := r.timeoutBudget(); ok {
+		rq.TimeoutBudget = pb.Int64(int64(budget / time.Microsecond))
 	}
 	return rq
 }
 
+// The time the server has for responding: our timeout if deadline propagation is enabled,
+// and at most the time left until the deadline of the calling context.
+func (r *Request) timeoutBudget() (time.Duration, bool) {
+	budget, ok := r.params.timeout, r.params.deadline_propagation
+
+	if r.ctx != nil && !r.ctx.GetDeadline().IsZero() {
+		if left := r.ctx.GetDeadline().Sub(time.Now()); !ok || left < budget {
+			budget, ok = left, true
+		}
+	}
+	if budget < 0 {
+		budget = 0
+	}
+	return budget, ok
+}
+
 // Send a request with a serialized protocol buffer
 func (r *Request) GoProto(msg pb.Message) Response {
 	payload, err := pb.Marshal(msg)
@@ -118,8 +238,24 @@ func (r *Request) Go(payload []byte) Response {
 		r.params.timeout = r.params.timeout - time.Now().Sub(before)
 		rp := r.callNextFilter(0)
 		r.client.request_active <- true
+
+		if r.one_way && rp.err != nil {
+			atomic.AddUint64(&r.client.oneway_failures, 1)
+		}
 		return rp
 	case <-timer.C:
+		if r.one_way {
+			atomic.AddUint64(&r.client.oneway_failures, 1)
+		}
 		return Response{err: errors.New("deadline expired on client")}
 	}
 }
+
+func hasMetadata(metadata []*proto.KeyValue, key string) bool {
+	for _, kv := range metadata {
+		if kv.GetKey() == key {
+			return true
+		}
+	}
+	return false
+}
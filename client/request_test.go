@@ -0,0 +1,55 @@
+package client
+
+import (
+	"testing"
+)
+
+func newMetadataTestRequest() *Request {
+	cl := &Client{name: "test-client", defaultParams: *NewParams()}
+	return &Request{client: cl, service: "Test", endpoint: "Metadata", params: cl.defaultParams}
+}
+
+func TestSetMetadata(t *testing.T) {
+	r := newMetadataTestRequest()
+
+	r.SetMetadata("a", "1").SetMetadata("b", "2").SetMetadata("a", "3")
+
+	rq := r.makeRPCRequestProto()
+
+	if len(rq.GetMetadata()) != 2 {
+		t.Fatal("Expected 2 metadata entries, got", rq.GetMetadata())
+	}
+	if kv := rq.GetMetadata()[0]; kv.GetKey() != "a" || kv.GetValue() != "3" {
+		t.Error("Entry wasn't replaced:", kv)
+	}
+	if kv := rq.GetMetadata()[1]; kv.GetKey() != "b" || kv.GetValue() != "2" {
+		t.Error("Unexpected entry:", kv)
+	}
+}
+
+func TestMetadataNotShared(t *testing.T) {
+	r := newMetadataTestRequest()
+	r.SetMetadata("a", "1")
+
+	// Appending to the metadata of a serialized request must not affect the Request.
+	rq := r.makeRPCRequestProto()
+	rq.Metadata = append(rq.Metadata, rq.Metadata[0])
+
+	r.SetMetadata("b", "2")
+
+	if len(r.metadata) != 2 || r.metadata[1].GetKey() != "b" {
+		t.Error("Request metadata was modified:", r.metadata)
+	}
+}
+
+func TestForwardMetadataWithoutContext(t *testing.T) {
+	r := newMetadataTestRequest()
+	r.SetParameters(NewParams().ForwardMetadata("user"))
+	r.SetMetadata("other", "x")
+
+	rq := r.makeRPCRequestProto()
+
+	if len(rq.GetMetadata()) != 1 || rq.GetMetadata()[0].GetKey() != "other" {
+		t.Error("Unexpected metadata:", rq.GetMetadata())
+	}
+}
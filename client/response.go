@@ -2,6 +2,7 @@ package client
 
 import (
 	"github.com/dermesser/clusterrpc/proto"
+	"time"
 
 	pb "github.com/gogo/protobuf/proto"
 )
@@ -16,6 +17,34 @@ func (rp *Response) Ok() bool {
 	return rp.err == nil && rp.response.GetResponseStatus() == proto.RPCResponse_STATUS_OK
 }
 
+// Returns the status sent by the server, or STATUS_UNKNOWN if no response was received
+// (in that case, Error() describes the client-side error).
+func (rp *Response) Status() proto.RPCResponse_Status {
+	return rp.response.GetResponseStatus()
+}
+
+// Returns the error message sent by the server, if any.
+func (rp *Response) ErrorMessage() string {
+	return rp.response.GetErrorMessage()
+}
+
+// Returns the value of a metadata entry set by the handler (see
+// server.Context.SetResponseMetadata()), or "" if there is none.
+func (rp *Response) GetMetadata(key string) string {
+	for _, kv := range rp.response.GetMetadata() {
+		if kv.GetKey() == key {
+			return kv.GetValue()
+		}
+	}
+	return ""
+}
+
+// If the server was overloaded (status STATUS_OVERLOADED_RETRY), returns how long the client
+// should wait before retrying; 0 if the server didn't tell.
+func (rp *Response) RetryAfter() time.Duration {
+	return time.Duration(rp.response.GetRetryAfter()) * time.Microsecond
+}
+
 // Returns the response payload.
 func (rp *Response) Payload() []byte {
 	return rp.response.GetResponseData()
@@ -0,0 +1,355 @@
+package client
+
+import (
+	"errors"
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	"github.com/dermesser/clusterrpc/server"
+	"io"
+
+	pb "github.com/gogo/protobuf/proto"
+	zmq "github.com/pebbe/zmq4"
+)
+
+/*
+A ResponseStream receives the responses of a streaming endpoint (see
+server.RegisterStreamingHandler()). It is an iterator: Call Next() until it returns an error;
+io.EOF signals that the stream has ended successfully.
+
+A ResponseStream uses a socket of its own, so the client can be used for other requests
+in the meantime. It is not safe for concurrent use.
+*/
+type ResponseStream struct {
+	rq   *Request
+	sock *zmq.Socket
+
+	// Template for control messages
+	control *proto.RPCRequest
+	// Responses received since the last credit was sent
+	received uint32
+	// Responses received while waiting for send credit (see BidiStream)
+	pending []*proto.RPCResponse
+	// Number of messages we may still send (see BidiStream)
+	send_credit uint32
+
+	// Set once the stream has ended (io.EOF if successful)
+	err error
+}
+
+/*
+Send a request to a streaming endpoint. Filters are not applied to streaming requests;
+the timeout applies to waiting for each single response.
+*/
+func (r *Request) GoStream(payload []byte) (*ResponseStream, error) {
+	return r.openStream(payload)
+}
+
+func (r *Request) openStream(payload []byte) (*ResponseStream, error) {
+	r.rpcid = log.GetLogToken()
+	r.payload = payload
+
+	sock, err := r.client.channel.newStreamSocket()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sock.SetRcvtimeo(r.params.timeout)
+	sock.SetSndtimeo(r.params.timeout)
+
+	request := r.makeRPCRequestProto()
+	request.StreamId = pb.String(r.rpcid)
+	request.StreamCredit = pb.Uint32(r.params.stream_window)
+
+	s := &ResponseStream{rq: r, sock: sock, send_credit: server.DEFAULT_STREAM_WINDOW}
+	s.control = &proto.RPCRequest{Srvc: request.Srvc, Procedure: request.Procedure, Data: []byte{},
+		CallerId: request.CallerId, RpcId: request.RpcId, StreamId: request.StreamId, StreamMessage: pb.Bool(true)}
+
+	err = s.send(request)
+
+	if err != nil {
+		sock.Close()
+		return nil, err
+	}
+
+	if log.IsLoggingEnabled(log.LOGLEVEL_INFO) {
+		log.CRPC_log(log.LOGLEVEL_INFO, "Opened stream", r.rpcid, "to", r.service, ".", r.endpoint)
+	}
+	return s, nil
+}
+
+/*
+Returns the payload of the next response. Returns io.EOF once the stream has ended
+successfully; if the stream failed, the returned error is a *Response describing the failure.
+*/
+func (s *ResponseStream) Next() ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var response *proto.RPCResponse
+	// Credit for buffered responses has been granted already.
+	buffered := len(s.pending) > 0
+
+	if buffered {
+		response = s.pending[0]
+		s.pending = s.pending[1:]
+	} else {
+		// Skip responses that only grant credit
+		for response == nil || response.GetStreamCredit() > 0 {
+			var err error
+			response, err = s.receive()
+
+			if err != nil {
+				return nil, s.finish(err)
+			}
+		}
+	}
+
+	if !response.GetStreamMore() {
+		s.mergeTrace(response.GetTraceinfo())
+
+		if response.GetResponseStatus() != proto.RPCResponse_STATUS_OK {
+			return nil, s.finish(&Response{response: response})
+		}
+
+		// Like the response to a unary request, the final response may be compressed.
+		if final := decompressResponse(Response{response: response}); final.err != nil {
+			return nil, s.finish(final.err)
+		}
+		s.finish(io.EOF)
+
+		// Data set by the handler with Context.Success() is the last response.
+		if len(response.GetResponseData()) > 0 {
+			return response.GetResponseData(), nil
+		}
+		return nil, io.EOF
+	}
+
+	if !buffered {
+		if err := s.grantCredit(); err != nil {
+			return nil, s.finish(err)
+		}
+	}
+
+	return response.GetResponseData(), nil
+}
+
+// Account for a response that has been received, and grant new credit when half of the window is used up.
+func (s *ResponseStream) grantCredit() error {
+	s.received++
+
+	if s.received >= (s.rq.params.stream_window+1)/2 {
+		control := *s.control
+		control.StreamCredit = pb.Uint32(s.received)
+
+		if err := s.send(&control); err != nil {
+			return err
+		}
+		s.received = 0
+	}
+	return nil
+}
+
+// Like Next(), but unmarshals the response into msg.
+func (s *ResponseStream) NextProto(msg pb.Message) error {
+	payload, err := s.Next()
+
+	if err != nil {
+		return err
+	}
+	return pb.Unmarshal(payload, msg)
+}
+
+// Abandon the stream, if it hasn't ended yet, and release its socket. The server is told to
+// cancel the stream.
+func (s *ResponseStream) Close() {
+	if s.err == nil {
+		control := *s.control
+		control.StreamCancel = pb.Bool(true)
+		s.send(&control)
+
+		s.finish(errors.New("Stream closed"))
+	}
+}
+
+// Receive the next message from the server. Responses granting credit are accounted for, but
+// returned as well.
+func (s *ResponseStream) receive() (*proto.RPCResponse, error) {
+	msgs, err := s.sock.RecvMessageBytes(0) // [correlation ID, "", RPCResponse]
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msgs) != 3 {
+		return nil, errors.New("Received stream message with unexpected format")
+	}
+
+	response := new(proto.RPCResponse)
+	err = response.Unmarshal(msgs[2])
+
+	if err != nil {
+		return nil, err
+	}
+
+	s.send_credit += response.GetStreamCredit()
+	return response, nil
+}
+
+func (s *ResponseStream) send(request *proto.RPCRequest) error {
+	buf, err := request.Marshal()
+
+	if err != nil {
+		return err
+	}
+
+	// Looks like a message from a REQ socket with REQ_CORRELATE to the server.
+	_, err = s.sock.SendMessage([]byte{0, 0, 0, 0}, []byte{}, buf)
+	return err
+}
+
+func (s *ResponseStream) finish(err error) error {
+	s.err = err
+	s.sock.Close()
+	return err
+}
+
+func (s *ResponseStream) mergeTrace(traceinfo *proto.TraceInfo) {
+	if traceinfo == nil {
+		return
+	}
+	if s.rq.trace != nil {
+		*s.rq.trace = *traceinfo
+	}
+	if s.rq.ctx != nil {
+		s.rq.ctx.AppendCallTrace(traceinfo)
+	}
+}
+
+/*
+A BidiStream is used for calling client-streaming and bidirectional streaming endpoints (see
+server.RegisterClientStreamingHandler() and server.RegisterBidiStreamingHandler()). Messages
+are sent with Send(); responses are received with Next() like on a ResponseStream.
+
+A client-streaming call is finished with CloseAndReceive(), which returns the single response.
+*/
+type BidiStream struct {
+	*ResponseStream
+
+	send_closed bool
+}
+
+/*
+Open a stream to a client-streaming or bidi streaming endpoint. payload is available to the
+handler as input of its Context; further messages are sent using the returned stream.
+*/
+func (r *Request) GoBidiStream(payload []byte) (*BidiStream, error) {
+	s, err := r.openStream(payload)
+
+	if err != nil {
+		return nil, err
+	}
+	return &BidiStream{ResponseStream: s}, nil
+}
+
+/*
+Send a message to the handler. Blocks while the server doesn't accept more messages (flow
+control); responses arriving meanwhile are kept for Next(), and credit is granted for them, so
+that a handler sending responses before receiving doesn't wait for a client sending messages
+before receiving. Returns io.EOF if the server has already ended the stream; the status can
+then be obtained from Next().
+*/
+func (s *BidiStream) Send(data []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.send_closed {
+		return errors.New("Stream was closed for sending")
+	}
+
+	for s.send_credit == 0 {
+		if len(s.pending) > 0 && !s.pending[len(s.pending)-1].GetStreamMore() {
+			return io.EOF
+		}
+
+		response, err := s.receive()
+
+		if err != nil {
+			return s.finish(err)
+		}
+
+		if response.GetStreamCredit() > 0 {
+			continue
+		}
+		s.pending = append(s.pending, response)
+
+		if response.GetStreamMore() {
+			if err := s.grantCredit(); err != nil {
+				return s.finish(err)
+			}
+		}
+	}
+
+	message := *s.control
+	message.Data = data
+
+	if err := s.send(&message); err != nil {
+		return s.finish(err)
+	}
+	s.send_credit--
+	return nil
+}
+
+// Send a serialized protocol buffer to the handler.
+func (s *BidiStream) SendProto(msg pb.Message) error {
+	buf, err := pb.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+	return s.Send(buf)
+}
+
+// Tell the handler that no further messages will be sent (half-close). Responses can still be
+// received.
+func (s *BidiStream) CloseSend() error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.send_closed {
+		return nil
+	}
+
+	control := *s.control
+	control.StreamHalfClose = pb.Bool(true)
+
+	if err := s.send(&control); err != nil {
+		return s.finish(err)
+	}
+	s.send_closed = true
+	return nil
+}
+
+/*
+Half-close the stream and wait for the final response of a client-streaming endpoint.
+Responses sent before the final one are discarded.
+*/
+func (s *BidiStream) CloseAndReceive() ([]byte, error) {
+	if err := s.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	var last []byte
+
+	for {
+		data, err := s.Next()
+
+		if err == io.EOF {
+			return last, nil
+		} else if err != nil {
+			return nil, err
+		}
+		last = data
+	}
+}
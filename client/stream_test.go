@@ -0,0 +1,100 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dermesser/clusterrpc/server"
+)
+
+const STREAM_TEST_PORT uint = 19532
+
+// The handler sends a full window of responses before receiving, while the client sends more
+// messages than the server buffers before receiving. Neither side may wait for the other's credit.
+func TestBidiStreamSendBeforeReceive(t *testing.T) {
+	const window = 4
+	const messages = server.DEFAULT_STREAM_WINDOW + 2*window
+
+	srv, err := server.NewServer("127.0.0.1", STREAM_TEST_PORT, 1, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.RegisterBidiStreamingHandler("Test", "Bidi", func(cx *server.Context, stream *server.ServerStream) {
+		for i := 0; i < window; i++ {
+			if err := stream.Send([]byte(fmt.Sprint(i))); err != nil {
+				cx.Fail(err.Error())
+				return
+			}
+		}
+
+		received := 0
+		for {
+			_, err := stream.Recv()
+
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				cx.Fail(err.Error())
+				return
+			}
+			received++
+		}
+		cx.Success([]byte(fmt.Sprint(received)))
+	})
+
+	if err = srv.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	defer srv.Stop()
+
+	channel, err := NewChannelAndConnect(Peer("127.0.0.1", STREAM_TEST_PORT), nil, SocketTimeout(5*time.Second))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cl := New("stream_test", channel)
+	defer cl.Destroy()
+
+	stream, err := cl.NewRequest("Test", "Bidi").
+		SetParameters(NewParams().StreamWindow(window).Timeout(5 * time.Second)).
+		GoBidiStream(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint32(0); i < messages; i++ {
+		if err := stream.Send([]byte("message")); err != nil {
+			t.Fatal("Send", i, "failed:", err)
+		}
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []string
+	for {
+		data, err := stream.Next()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, string(data))
+	}
+
+	if len(responses) != window+1 {
+		t.Fatal("Unexpected responses:", responses)
+	}
+	if final := responses[window]; final != fmt.Sprint(messages) {
+		t.Error("Handler received", final, "messages instead of", messages)
+	}
+}
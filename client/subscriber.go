@@ -0,0 +1,145 @@
+package client
+
+import (
+	"errors"
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	smgr "github.com/dermesser/clusterrpc/securitymanager"
+	"time"
+
+	pb "github.com/gogo/protobuf/proto"
+	zmq "github.com/pebbe/zmq4"
+)
+
+// A message received from a publisher (see server.Publisher).
+type Message struct {
+	Topic     string
+	Sequence  uint64
+	Data      []byte
+	Published time.Time
+	// Set if one or more messages on this topic were lost before this one. The application
+	// should resync the topic's state, e.g. by using a normal RPC.
+	Gap bool
+}
+
+// Unmarshals the message data into msg.
+func (m *Message) GetMessage(msg pb.Message) error {
+	return pb.Unmarshal(m.Data, msg)
+}
+
+// A GapHandler is called when messages on topic were lost; expected is the sequence number
+// that should have been received next, received the one that was actually received.
+type GapHandler func(topic string, expected, received uint64)
+
+/*
+A Subscriber receives messages from one or more publishers. It is not safe for concurrent use.
+*/
+type Subscriber struct {
+	sock        *zmq.Socket
+	last        map[string]uint64
+	gap_handler GapHandler
+}
+
+// Create a new subscriber. security_manager may be nil.
+func NewSubscriber(security_manager *smgr.ClientSecurityManager) (*Subscriber, error) {
+	s := &Subscriber{last: make(map[string]uint64)}
+
+	var err error
+	s.sock, err = zmq.NewSocket(zmq.SUB)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when creating SUB socket:", err.Error())
+		return nil, err
+	}
+
+	err = security_manager.ApplyToClientSocket(s.sock)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when setting up security:", err.Error())
+		s.sock.Close()
+		return nil, err
+	}
+
+	s.sock.SetIpv6(true)
+	s.sock.SetLinger(0)
+	s.sock.SetReconnectIvl(100 * time.Millisecond)
+
+	return s, nil
+}
+
+// Connect to a publisher. Can be called several times to receive messages from multiple
+// publishers; they should then use different topics, otherwise gaps can't be detected.
+func (s *Subscriber) Connect(addr PeerAddress) error {
+	err := s.sock.Connect(addr.ToUrl())
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not connect to publisher", addr.String(), ":", err.Error())
+	}
+	return err
+}
+
+// Receive messages on all topics starting with prefix. The empty prefix matches all topics.
+func (s *Subscriber) Subscribe(prefix string) error {
+	return s.sock.SetSubscribe(prefix)
+}
+
+// Stop receiving messages for a prefix given to Subscribe().
+func (s *Subscriber) Unsubscribe(prefix string) error {
+	return s.sock.SetUnsubscribe(prefix)
+}
+
+// Set a function that is called when lost messages are detected (in addition to Message.Gap being set).
+func (s *Subscriber) SetGapHandler(h GapHandler) {
+	s.gap_handler = h
+}
+
+// Set the time Receive() waits for a message. By default, it waits forever.
+func (s *Subscriber) SetTimeout(d time.Duration) {
+	s.sock.SetRcvtimeo(d)
+}
+
+// Wait for the next message.
+func (s *Subscriber) Receive() (*Message, error) {
+	msgs, err := s.sock.RecvMessageBytes(0) // [topic, PubSubMessage]
+
+	if err != nil {
+		return nil, err
+	}
+	return s.decode(msgs)
+}
+
+// Decode a message received from a publisher and check its sequence number.
+func (s *Subscriber) decode(msgs [][]byte) (*Message, error) {
+	if len(msgs) != 2 {
+		return nil, errors.New("Received message with unexpected format")
+	}
+
+	envelope := new(proto.PubSubMessage)
+	err := envelope.Unmarshal(msgs[1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{Topic: envelope.GetTopic(), Sequence: envelope.GetSequence(), Data: envelope.GetData(),
+		Published: time.Unix(0, 1000*envelope.GetPublishedTime())}
+
+	// The first message on a topic can't be checked; a lower sequence number than expected
+	// means that the publisher was restarted.
+	if last, ok := s.last[msg.Topic]; ok && msg.Sequence != last+1 {
+		msg.Gap = true
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Lost messages on topic", msg.Topic, ": expected", last+1, "got", msg.Sequence)
+
+		if s.gap_handler != nil {
+			s.gap_handler(msg.Topic, last+1, msg.Sequence)
+		}
+	}
+	s.last[msg.Topic] = msg.Sequence
+
+	return msg, nil
+}
+
+// Close the subscriber's socket.
+func (s *Subscriber) Close() {
+	s.sock.Close()
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func publishedMessage(t *testing.T, topic string, sequence uint64) [][]byte {
+	buf, err := (&proto.PubSubMessage{Topic: pb.String(topic), Sequence: pb.Uint64(sequence),
+		Data: []byte("data"), PublishedTime: pb.Int64(1000)}).Marshal()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	return [][]byte{[]byte(topic), buf}
+}
+
+func TestSubscriberDetectsGaps(t *testing.T) {
+	s := &Subscriber{last: make(map[string]uint64)}
+	var gaps []uint64
+
+	s.SetGapHandler(func(topic string, expected, received uint64) {
+		gaps = append(gaps, expected, received)
+	})
+
+	for _, m := range []struct {
+		topic    string
+		sequence uint64
+		gap      bool
+	}{
+		{"a", 5, false}, // first message on the topic
+		{"a", 6, false},
+		{"b", 1, false},
+		{"a", 8, true},
+		{"b", 2, false},
+		{"a", 1, true}, // publisher restarted
+	} {
+		msg, err := s.decode(publishedMessage(t, m.topic, m.sequence))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Topic != m.topic || msg.Sequence != m.sequence || string(msg.Data) != "data" || msg.Gap != m.gap {
+			t.Error("unexpected message:", msg)
+		}
+	}
+
+	if len(gaps) != 4 || gaps[0] != 7 || gaps[1] != 8 || gaps[2] != 9 || gaps[3] != 1 {
+		t.Error("unexpected gaps:", gaps)
+	}
+
+	if _, err := s.decode([][]byte{[]byte("a")}); err == nil {
+		t.Error("message without envelope accepted")
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Package compression provides the codecs used by clusterrpc for compressing request and
+response payloads.
+
+Codecs are looked up by name in a registry. gzip is always available; others (e.g. snappy or
+zstd) can be added by implementing Compressor and calling Register() at startup, on both
+clients and servers. A server that receives a request compressed with a codec it doesn't know
+responds with STATUS_UNSUPPORTED_COMPRESSION, and the client falls back to sending the
+request uncompressed.
+*/
+package compression
+
+import (
+	"errors"
+	"sync"
+)
+
+// Payloads smaller than this (in bytes) are not compressed by default.
+const DEFAULT_THRESHOLD int = 1024
+
+// A Compressor implements a compression codec. It must be safe for concurrent use.
+type Compressor interface {
+	// The name identifying the codec on the wire, e.g. "gzip"
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var registry_lock sync.RWMutex
+var registry = make(map[string]Compressor)
+
+// Make a codec available under its name. An already registered codec with the same name is replaced.
+func Register(c Compressor) {
+	registry_lock.Lock()
+	defer registry_lock.Unlock()
+
+	registry[c.Name()] = c
+}
+
+// Returns the codec with this name, or nil if there is none.
+func Get(name string) Compressor {
+	registry_lock.RLock()
+	defer registry_lock.RUnlock()
+
+	return registry[name]
+}
+
+// Decompress data using the codec with this name.
+func Decompress(name string, data []byte) ([]byte, error) {
+	c := Get(name)
+
+	if c == nil {
+		return nil, errors.New("Unsupported compression: " + name)
+	}
+	return c.Decompress(data)
+}
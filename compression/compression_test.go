@@ -0,0 +1,64 @@
+package compression
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGzipRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("clusterrpc "), 1000)
+	c := Get(GZIP)
+
+	if c == nil {
+		t.Fatal("gzip is not registered")
+	}
+
+	compressed, err := c.Compress(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(data) {
+		t.Error("Compressed data is not smaller:", len(compressed), len(data))
+	}
+
+	// Twice, to use a pooled writer
+	compressed, err = c.Compress(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decompressed, err := Decompress(GZIP, compressed)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, decompressed) {
+		t.Error("Round trip changed data")
+	}
+}
+
+type nopCompressor struct{}
+
+func (c nopCompressor) Name() string                           { return "nop" }
+func (c nopCompressor) Compress(data []byte) ([]byte, error)   { return data, nil }
+func (c nopCompressor) Decompress(data []byte) ([]byte, error) { return data, nil }
+
+func TestRegistry(t *testing.T) {
+	if Get("nop") != nil {
+		t.Fatal("Unregistered codec found")
+	}
+	if _, err := Decompress("nop", []byte("x")); err == nil {
+		t.Error("Decompressing with unknown codec succeeded")
+	}
+
+	Register(nopCompressor{})
+
+	if Get("nop") == nil {
+		t.Fatal("Registered codec not found")
+	}
+	if out, err := Decompress("nop", []byte("x")); err != nil || string(out) != "x" {
+		t.Error("Unexpected result:", string(out), err)
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestRoutes(t *testing.T) {
+	r := make(routes)
+
+	if err := r.Set("LockService=tcp://10.0.0.1:9000,tcp://10.0.0.2:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set("LockService=tcp://10.0.0.3:9000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Set("*=ipc:///run/backend.sock"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r["LockService"]) != 3 || r["LockService"][2] != "tcp://10.0.0.3:9000" {
+		t.Error("unexpected backends:", r["LockService"])
+	}
+	if len(r["*"]) != 1 || r["*"][0] != "ipc:///run/backend.sock" {
+		t.Error("unexpected default route:", r["*"])
+	}
+
+	for _, bad := range []string{"LockService", "=tcp://10.0.0.1:9000", "LockService="} {
+		if r.Set(bad) == nil {
+			t.Error("bad route accepted:", bad)
+		}
+	}
+}
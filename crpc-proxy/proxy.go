@@ -0,0 +1,124 @@
+/*
+crpc-proxy accepts clusterrpc requests on one address and forwards them, depending on the
+requested service, to pools of backend servers. Example:
+
+	$ crpc-proxy -listen tcp://*:9000 \
+	    -route LockService=tcp://10.0.0.1:9000,tcp://10.0.0.2:9000 \
+	    -route '*=tcp://10.0.0.3:9000'
+
+The route for service * is used for all services without a route of their own.
+
+CURVE security is enabled on the frontend by -frontend_pub/-frontend_priv (the server key
+pair clients connect to), and on the backend connections by -backend_pub/-backend_priv (the
+client key pair of the proxy) together with -backend_server_pub.
+*/
+package main
+
+import (
+	"github.com/dermesser/clusterrpc/log"
+	smgr "github.com/dermesser/clusterrpc/securitymanager"
+	"github.com/dermesser/clusterrpc/server"
+
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Collects -route flags.
+type routes map[string][]string
+
+func (r routes) String() string {
+	return fmt.Sprint(map[string][]string(r))
+}
+
+func (r routes) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("route must have the format Service=url[,url...]")
+	}
+	r[parts[0]] = append(r[parts[0]], strings.Split(parts[1], ",")...)
+	return nil
+}
+
+func main() {
+	var listen, name, frontend_pub, frontend_priv, backend_pub, backend_priv, backend_server_pub string
+	var timeout time.Duration
+	var loglevel int
+	backends := make(routes)
+
+	flag.StringVar(&listen, "listen", "tcp://*:9000", "Comma-separated list of URLs to accept requests on")
+	flag.Var(backends, "route", "Service=url[,url...]; can be given several times. Use * as service for a default route.")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "How long to wait for a backend response")
+	flag.StringVar(&name, "name", "", "Machine name shown in traces (default: hostname)")
+	flag.StringVar(&frontend_pub, "frontend_pub", "", "Public key file for the frontend (enables CURVE)")
+	flag.StringVar(&frontend_priv, "frontend_priv", "", "Private key file for the frontend")
+	flag.StringVar(&backend_pub, "backend_pub", "", "Public key file used when connecting to backends (enables CURVE)")
+	flag.StringVar(&backend_priv, "backend_priv", "", "Private key file used when connecting to backends")
+	flag.StringVar(&backend_server_pub, "backend_server_pub", "", "Public key file of the backend servers")
+	flag.IntVar(&loglevel, "loglevel", log.LOGLEVEL_WARNINGS, "Log level (0 = none ... 4 = debug)")
+
+	flag.Parse()
+
+	log.SetLoglevel(loglevel)
+
+	if len(backends) == 0 {
+		fmt.Println("No routes given; use -route")
+		os.Exit(1)
+	}
+
+	var server_security_manager *smgr.ServerSecurityManager
+	var client_security_manager *smgr.ClientSecurityManager
+
+	if frontend_pub != "" {
+		server_security_manager = smgr.NewServerSecurityManager()
+
+		if err := server_security_manager.LoadKeys(frontend_pub, frontend_priv); err != nil {
+			fmt.Println("Could not load frontend keys:", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	if backend_pub != "" {
+		client_security_manager = smgr.NewClientSecurityManager()
+
+		if err := client_security_manager.LoadKeys(backend_pub, backend_priv); err != nil {
+			fmt.Println("Could not load backend keys:", err.Error())
+			os.Exit(1)
+		}
+		if err := client_security_manager.LoadServerPubkey(backend_server_pub); err != nil {
+			fmt.Println("Could not load backend server key:", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	proxy, err := server.NewProxy(strings.Split(listen, ","), server_security_manager)
+
+	if err != nil {
+		fmt.Println("Could not create proxy:", err.Error())
+		os.Exit(1)
+	}
+	defer proxy.Close()
+
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	proxy.SetMachineName(name)
+	proxy.SetTimeout(timeout)
+
+	for service, urls := range backends {
+		if err := proxy.AddBackends(service, urls, client_security_manager); err != nil {
+			fmt.Println("Could not add backends for", service, ":", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	err = proxy.Run()
+
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
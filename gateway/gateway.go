@@ -0,0 +1,318 @@
+/*
+Package gateway makes clusterrpc services available over HTTP, for clients that can't speak
+ZeroMQ (web frontends, curl, ...).
+
+A request
+
+	POST /{service}/{endpoint}
+
+is sent as RPC to service.endpoint on the backend configured for service. The body is
+passed through as raw payload, unless the request has the content type application/json
+and message types have been registered for the endpoint with RegisterJSON(); then the
+body is transcoded from JSON to protobuf, and the response back to JSON.
+
+The RPC status is mapped to an HTTP status code (see HTTPStatus()) and sent in the
+X-Clusterrpc-Status header. A timeout for the RPC can be given in the X-Clusterrpc-Timeout
+header (e.g. "250ms"); it is propagated to the backend as timeout budget.
+*/
+package gateway
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dermesser/clusterrpc/client"
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	smgr "github.com/dermesser/clusterrpc/securitymanager"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/jsonpb"
+	pb "github.com/gogo/protobuf/proto"
+)
+
+const TIMEOUT_HEADER = "X-Clusterrpc-Timeout"
+const STATUS_HEADER = "X-Clusterrpc-Status"
+
+// Requests with larger bodies are refused.
+const MAX_BODY_SIZE int64 = 16 * 1024 * 1024
+
+// Message types for transcoding an endpoint's request and response.
+type jsonEndpoint struct {
+	request, response reflect.Type
+}
+
+// A Gateway is an http.Handler forwarding requests to clusterrpc servers.
+type Gateway struct {
+	cache            *client.ConnectionCache
+	security_manager *smgr.ClientSecurityManager
+
+	mx              sync.RWMutex
+	backends        map[string]client.PeerAddress
+	default_backend *client.PeerAddress
+	json            map[string]jsonEndpoint
+	timeout         time.Duration
+}
+
+/*
+Create a new gateway. client_name is sent as caller ID with every RPC; security_manager
+is used for connections to backends and may be nil.
+*/
+func NewGateway(client_name string, security_manager *smgr.ClientSecurityManager) *Gateway {
+	return &Gateway{cache: client.NewConnCache(client_name), security_manager: security_manager,
+		backends: make(map[string]client.PeerAddress), json: make(map[string]jsonEndpoint),
+		timeout: 10 * time.Second}
+}
+
+// Route requests for service to peer.
+func (gw *Gateway) AddBackend(service string, peer client.PeerAddress) {
+	gw.mx.Lock()
+	defer gw.mx.Unlock()
+
+	gw.backends[service] = peer
+}
+
+// Route requests for services without a backend set by AddBackend() to peer. Without
+// a default backend, such requests are answered with 404.
+func (gw *Gateway) SetDefaultBackend(peer client.PeerAddress) {
+	gw.mx.Lock()
+	defer gw.mx.Unlock()
+
+	gw.default_backend = &peer
+}
+
+// Set the timeout used for RPCs that don't specify one in the X-Clusterrpc-Timeout header (default 10s).
+func (gw *Gateway) SetTimeout(d time.Duration) {
+	gw.mx.Lock()
+	defer gw.mx.Unlock()
+
+	gw.timeout = d
+}
+
+/*
+Enable JSON transcoding for service.endpoint. request_type and response_type are the fully
+qualified names of protobuf messages that are registered with the protobuf library (i.e.,
+whose generated code is linked into the program), e.g. "mypackage.LockRequest".
+*/
+func (gw *Gateway) RegisterJSON(service, endpoint, request_type, response_type string) error {
+	rqtype, rptype := pb.MessageType(request_type), pb.MessageType(response_type)
+
+	if rqtype == nil || rptype == nil {
+		return fmt.Errorf("Unknown message type(s): %s, %s", request_type, response_type)
+	}
+
+	gw.mx.Lock()
+	defer gw.mx.Unlock()
+
+	gw.json[service+"."+endpoint] = jsonEndpoint{request: rqtype, response: rptype}
+	return nil
+}
+
+// Close all connections to backends.
+func (gw *Gateway) Close() {
+	gw.cache.CloseAll()
+}
+
+/*
+Maps an RPC status to an HTTP status code. Statuses describing errors on the client side
+(i.e., in the gateway) are mapped to 502 Bad Gateway.
+*/
+func HTTPStatus(s proto.RPCResponse_Status) int {
+	switch s {
+	case proto.RPCResponse_STATUS_OK:
+		return http.StatusOK
+	case proto.RPCResponse_STATUS_NOT_FOUND:
+		return http.StatusNotFound
+	case proto.RPCResponse_STATUS_NOT_OK, proto.RPCResponse_STATUS_SERVER_ERROR:
+		return http.StatusInternalServerError
+	case proto.RPCResponse_STATUS_TIMEOUT, proto.RPCResponse_STATUS_MISSED_DEADLINE:
+		return http.StatusGatewayTimeout
+	case proto.RPCResponse_STATUS_QUOTA_EXCEEDED:
+		return http.StatusTooManyRequests
+	case proto.RPCResponse_STATUS_NOT_SUPPORTED:
+		return http.StatusNotImplemented
+	case proto.RPCResponse_STATUS_OVERLOADED_RETRY, proto.RPCResponse_STATUS_LOADSHED,
+		proto.RPCResponse_STATUS_UNHEALTHY:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func (gw *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "Path must be /{service}/{endpoint}", http.StatusNotFound)
+		return
+	}
+	service, endpoint := parts[0], parts[1]
+
+	peer, timeout, json_endpoint, transcode, err := gw.lookup(r, service, endpoint)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if h := r.Header.Get(TIMEOUT_HEADER); h != "" {
+		timeout, err = time.ParseDuration(h)
+
+		if err != nil || timeout <= 0 {
+			http.Error(w, "Bad "+TIMEOUT_HEADER+" header", http.StatusBadRequest)
+			return
+		}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, MAX_BODY_SIZE+1))
+
+	if err != nil {
+		http.Error(w, "Could not read request: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if int64(len(body)) > MAX_BODY_SIZE {
+		http.Error(w, "Request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if transcode {
+		body, err = jsonToProto(body, json_endpoint.request)
+
+		if err != nil {
+			http.Error(w, "Could not transcode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rp, err := gw.call(peer, service, endpoint, timeout, body)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Gateway could not connect to", peer.String(), ":", err.Error())
+		http.Error(w, "Could not connect to backend", http.StatusBadGateway)
+		return
+	}
+
+	writeResponse(w, &rp, json_endpoint, transcode)
+}
+
+// The parts of a client.Response needed for answering an HTTP request.
+type rpcResult interface {
+	Ok() bool
+	Status() proto.RPCResponse_Status
+	ErrorMessage() string
+	Error() string
+	RetryAfter() time.Duration
+	Payload() []byte
+}
+
+// Send the result of an RPC as HTTP response, transcoding the payload to JSON if transcode is set.
+func writeResponse(w http.ResponseWriter, rp rpcResult, json_endpoint jsonEndpoint, transcode bool) {
+	w.Header().Set(STATUS_HEADER, rp.Status().String())
+
+	if !rp.Ok() {
+		message := rp.ErrorMessage()
+		if message == "" {
+			message = rp.Error()
+		}
+		if rp.RetryAfter() > 0 {
+			// Whole seconds, rounded up
+			w.Header().Set("Retry-After", strconv.Itoa(int((rp.RetryAfter()+time.Second-1)/time.Second)))
+		}
+		http.Error(w, message, HTTPStatus(rp.Status()))
+		return
+	}
+
+	payload := rp.Payload()
+
+	if transcode {
+		var err error
+		payload, err = protoToJSON(payload, json_endpoint.response)
+
+		if err != nil {
+			http.Error(w, "Could not transcode response: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(payload)
+}
+
+// Find backend and settings for a request.
+func (gw *Gateway) lookup(r *http.Request, service, endpoint string) (client.PeerAddress, time.Duration, jsonEndpoint, bool, error) {
+	gw.mx.RLock()
+	defer gw.mx.RUnlock()
+
+	peer, ok := gw.backends[service]
+
+	if !ok {
+		if gw.default_backend == nil {
+			return peer, 0, jsonEndpoint{}, false, errors.New("Unknown service " + service)
+		}
+		peer = *gw.default_backend
+	}
+
+	json_endpoint, ok := gw.json[service+"."+endpoint]
+	transcode := ok && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+
+	return peer, gw.timeout, json_endpoint, transcode, nil
+}
+
+// Send the RPC using a cached connection. Returns an error if no connection could be established.
+func (gw *Gateway) call(peer client.PeerAddress, service, endpoint string, timeout time.Duration, payload []byte) (client.Response, error) {
+	cl, err := gw.cache.Connect(peer, gw.security_manager)
+
+	if err != nil {
+		return client.Response{}, err
+	}
+
+	rp := cl.NewRequest(service, endpoint).SetParameters(
+		client.NewParams().Timeout(timeout).DeadlinePropagation(true)).Go(payload)
+
+	if rp.Status() == proto.RPCResponse_STATUS_UNKNOWN {
+		// Network error; don't reuse the connection.
+		cl.Destroy()
+	} else {
+		gw.cache.Return(&cl)
+	}
+	return rp, nil
+}
+
+func jsonToProto(body []byte, t reflect.Type) ([]byte, error) {
+	msg := reflect.New(t.Elem()).Interface().(pb.Message)
+
+	err := jsonpb.Unmarshal(bytes.NewReader(body), msg)
+
+	if err != nil {
+		return nil, err
+	}
+	return pb.Marshal(msg)
+}
+
+func protoToJSON(payload []byte, t reflect.Type) ([]byte, error) {
+	msg := reflect.New(t.Elem()).Interface().(pb.Message)
+
+	err := pb.Unmarshal(payload, msg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	err = (&jsonpb.Marshaler{OrigName: true}).Marshal(buf, msg)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,157 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dermesser/clusterrpc/client"
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+// An rpcResult as returned by a backend.
+type testResult struct {
+	status      proto.RPCResponse_Status
+	message     string
+	retry_after time.Duration
+	payload     []byte
+}
+
+func (r *testResult) Ok() bool                         { return r.status == proto.RPCResponse_STATUS_OK }
+func (r *testResult) Status() proto.RPCResponse_Status { return r.status }
+func (r *testResult) ErrorMessage() string             { return r.message }
+func (r *testResult) Error() string                    { return r.status.String() }
+func (r *testResult) RetryAfter() time.Duration        { return r.retry_after }
+func (r *testResult) Payload() []byte                  { return r.payload }
+
+func TestHTTPStatus(t *testing.T) {
+	cases := map[proto.RPCResponse_Status]int{
+		proto.RPCResponse_STATUS_OK:                   http.StatusOK,
+		proto.RPCResponse_STATUS_NOT_FOUND:            http.StatusNotFound,
+		proto.RPCResponse_STATUS_NOT_OK:               http.StatusInternalServerError,
+		proto.RPCResponse_STATUS_MISSED_DEADLINE:      http.StatusGatewayTimeout,
+		proto.RPCResponse_STATUS_QUOTA_EXCEEDED:       http.StatusTooManyRequests,
+		proto.RPCResponse_STATUS_NOT_SUPPORTED:        http.StatusNotImplemented,
+		proto.RPCResponse_STATUS_LOADSHED:             http.StatusServiceUnavailable,
+		proto.RPCResponse_STATUS_CLIENT_NETWORK_ERROR: http.StatusBadGateway,
+	}
+
+	for s, code := range cases {
+		if HTTPStatus(s) != code {
+			t.Error("HTTPStatus", s, "=", HTTPStatus(s), "instead of", code)
+		}
+	}
+}
+
+func TestRetryAfterRoundedUp(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeResponse(w, &testResult{status: proto.RPCResponse_STATUS_OVERLOADED_RETRY, message: "busy",
+		retry_after: 1500 * time.Millisecond}, jsonEndpoint{}, false)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Error("unexpected status:", w.Code)
+	}
+	if h := w.Header().Get("Retry-After"); h != "2" {
+		t.Error("unexpected Retry-After:", h)
+	}
+	if h := w.Header().Get(STATUS_HEADER); h != "STATUS_OVERLOADED_RETRY" {
+		t.Error("unexpected status header:", h)
+	}
+	if !strings.Contains(w.Body.String(), "busy") {
+		t.Error("error message missing:", w.Body.String())
+	}
+}
+
+func TestJSONTranscoding(t *testing.T) {
+	gw := NewGateway("gateway_test", nil)
+	gw.AddBackend("Test", client.Peer("127.0.0.1", 9000))
+
+	if err := gw.RegisterJSON("Test", "Echo", "proto.KeyValue", "proto.KeyValue"); err != nil {
+		t.Fatal(err)
+	}
+	if gw.RegisterJSON("Test", "Other", "proto.NoSuchMessage", "proto.KeyValue") == nil {
+		t.Fatal("unknown message type accepted")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/Test/Echo", strings.NewReader(`{"key": "k", "value": "v"}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	_, _, json_endpoint, transcode, err := gw.lookup(r, "Test", "Echo")
+
+	if err != nil || !transcode {
+		t.Fatal("request not transcoded:", err)
+	}
+
+	payload, err := jsonToProto([]byte(`{"key": "k", "value": "v"}`), json_endpoint.request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv := new(proto.KeyValue)
+	if err = pb.Unmarshal(payload, kv); err != nil || kv.GetKey() != "k" || kv.GetValue() != "v" {
+		t.Fatal("unexpected message:", kv, err)
+	}
+
+	w := httptest.NewRecorder()
+	writeResponse(w, &testResult{status: proto.RPCResponse_STATUS_OK, payload: payload}, json_endpoint, true)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatal("unexpected response:", w.Code, w.Header())
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"key":"k"`) || !strings.Contains(body, `"value":"v"`) {
+		t.Error("unexpected JSON:", body)
+	}
+
+	// Without the JSON content type, the body is passed through.
+	r.Header.Set("Content-Type", "application/octet-stream")
+
+	if _, _, _, transcode, _ = gw.lookup(r, "Test", "Echo"); transcode {
+		t.Error("raw request transcoded")
+	}
+}
+
+func TestBadRequests(t *testing.T) {
+	gw := NewGateway("gateway_test", nil)
+	gw.AddBackend("Test", client.Peer("127.0.0.1", 9000))
+
+	cases := []struct {
+		method, path, timeout string
+		code                  int
+	}{
+		{http.MethodGet, "/Test/Echo", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/Test", "", http.StatusNotFound},
+		{http.MethodPost, "/Unknown/Echo", "", http.StatusNotFound},
+		{http.MethodPost, "/Test/Echo", "soon", http.StatusBadRequest},
+		{http.MethodPost, "/Test/Echo", "-1s", http.StatusBadRequest},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(""))
+		if c.timeout != "" {
+			r.Header.Set(TIMEOUT_HEADER, c.timeout)
+		}
+		w := httptest.NewRecorder()
+		gw.ServeHTTP(w, r)
+
+		if w.Code != c.code {
+			t.Error(c.method, c.path, c.timeout, "answered with", w.Code, "instead of", c.code)
+		}
+	}
+}
+
+func TestErrorMessageFallback(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeResponse(w, &testResult{status: proto.RPCResponse_STATUS_NOT_FOUND}, jsonEndpoint{}, false)
+
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "STATUS_NOT_FOUND") {
+		t.Error("unexpected response:", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Error("Retry-After without hint")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,7 +29,9 @@ func init() {
 }
 
 var logger *log.Logger
-var loglevel int
+
+// Accessed atomically; it may be changed while other goroutines are logging.
+var loglevel int32
 
 const logger_flags = log.LstdFlags | log.Lmicroseconds
 
@@ -40,17 +43,22 @@ func loglevel_to_string(loglevel int) string {
 
 // Set the global RPC log level
 func SetLoglevel(ll int) {
-	loglevel = ll
+	atomic.StoreInt32(&loglevel, int32(ll))
+}
+
+// Get the global RPC log level
+func GetLoglevel() int {
+	return int(atomic.LoadInt32(&loglevel))
 }
 
 // Performance-enhancer: Prevent unnecessary log calls
 func IsLoggingEnabled(ll int) bool {
-	return loglevel >= ll
+	return GetLoglevel() >= ll
 }
 
 func CRPC_log(ll int, what ...interface{}) {
-	if ll <= loglevel {
-		logger.Printf("%s: %s", loglevel_to_string(loglevel), fmt.Sprintln(what...))
+	if current := GetLoglevel(); ll <= current {
+		logger.Printf("%s: %s", loglevel_to_string(current), fmt.Sprintln(what...))
 	}
 }
 
@@ -9,3 +9,16 @@ func TestRandomStringIsRandom(t *testing.T) {
 		t.Fatal("strings are equal:", a, b)
 	}
 }
+
+func TestSetLoglevel(t *testing.T) {
+	defer SetLoglevel(GetLoglevel())
+
+	SetLoglevel(LOGLEVEL_WARNINGS)
+
+	if GetLoglevel() != LOGLEVEL_WARNINGS {
+		t.Fatal("unexpected log level:", GetLoglevel())
+	}
+	if !IsLoggingEnabled(LOGLEVEL_ERRORS) || IsLoggingEnabled(LOGLEVEL_INFO) {
+		t.Fatal("IsLoggingEnabled doesn't match log level")
+	}
+}
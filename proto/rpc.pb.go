@@ -21,7 +21,7 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
-const _ = proto.GoGoProtoPackageIsVersion2 // please upgrade the proto package
+const _ = proto.GoGoProtoPackageIsVersion3 // please upgrade the proto package
 
 type RPCResponse_Status int32
 
@@ -53,6 +53,12 @@ const (
 	RPCResponse_STATUS_LOADSHED RPCResponse_Status = 13
 	// Health check failed
 	RPCResponse_STATUS_UNHEALTHY RPCResponse_Status = 14
+	// The request was compressed with a codec the server doesn't support
+	RPCResponse_STATUS_UNSUPPORTED_COMPRESSION RPCResponse_Status = 15
+	// The caller has exceeded its quota on the server (429)
+	RPCResponse_STATUS_QUOTA_EXCEEDED RPCResponse_Status = 16
+	// The request needs a feature the server (or a proxy on the way) doesn't support, e.g. streaming
+	RPCResponse_STATUS_NOT_SUPPORTED RPCResponse_Status = 17
 )
 
 var RPCResponse_Status_name = map[int32]string{
@@ -69,22 +75,28 @@ var RPCResponse_Status_name = map[int32]string{
 	12: "STATUS_MISSED_DEADLINE",
 	13: "STATUS_LOADSHED",
 	14: "STATUS_UNHEALTHY",
+	15: "STATUS_UNSUPPORTED_COMPRESSION",
+	16: "STATUS_QUOTA_EXCEEDED",
+	17: "STATUS_NOT_SUPPORTED",
 }
 
 var RPCResponse_Status_value = map[string]int32{
-	"STATUS_UNKNOWN":              0,
-	"STATUS_OK":                   1,
-	"STATUS_NOT_FOUND":            2,
-	"STATUS_NOT_OK":               4,
-	"STATUS_SERVER_ERROR":         5,
-	"STATUS_TIMEOUT":              6,
-	"STATUS_OVERLOADED_RETRY":     7,
-	"STATUS_CLIENT_REQUEST_ERROR": 9,
-	"STATUS_CLIENT_NETWORK_ERROR": 10,
-	"STATUS_CLIENT_CALLED_WRONG":  11,
-	"STATUS_MISSED_DEADLINE":      12,
-	"STATUS_LOADSHED":             13,
-	"STATUS_UNHEALTHY":            14,
+	"STATUS_UNKNOWN":                 0,
+	"STATUS_OK":                      1,
+	"STATUS_NOT_FOUND":               2,
+	"STATUS_NOT_OK":                  4,
+	"STATUS_SERVER_ERROR":            5,
+	"STATUS_TIMEOUT":                 6,
+	"STATUS_OVERLOADED_RETRY":        7,
+	"STATUS_CLIENT_REQUEST_ERROR":    9,
+	"STATUS_CLIENT_NETWORK_ERROR":    10,
+	"STATUS_CLIENT_CALLED_WRONG":     11,
+	"STATUS_MISSED_DEADLINE":         12,
+	"STATUS_LOADSHED":                13,
+	"STATUS_UNHEALTHY":               14,
+	"STATUS_UNSUPPORTED_COMPRESSION": 15,
+	"STATUS_QUOTA_EXCEEDED":          16,
+	"STATUS_NOT_SUPPORTED":           17,
 }
 
 func (x RPCResponse_Status) Enum() *RPCResponse_Status {
@@ -107,20 +119,22 @@ func (x *RPCResponse_Status) UnmarshalJSON(data []byte) error {
 }
 
 func (RPCResponse_Status) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_d74a5129edc93dca, []int{2, 0}
+	return fileDescriptor_d74a5129edc93dca, []int{3, 0}
 }
 
 type TraceInfo struct {
-	ReceivedTime         *int64       `protobuf:"varint,1,req,name=received_time,json=receivedTime" json:"received_time,omitempty"`
-	RepliedTime          *int64       `protobuf:"varint,2,req,name=replied_time,json=repliedTime" json:"replied_time,omitempty"`
-	MachineName          *string      `protobuf:"bytes,3,opt,name=machine_name,json=machineName" json:"machine_name,omitempty"`
-	EndpointName         *string      `protobuf:"bytes,4,opt,name=endpoint_name,json=endpointName" json:"endpoint_name,omitempty"`
-	ErrorMessage         *string      `protobuf:"bytes,5,opt,name=error_message,json=errorMessage" json:"error_message,omitempty"`
-	Redirect             *string      `protobuf:"bytes,6,opt,name=redirect" json:"redirect,omitempty"`
-	ChildCalls           []*TraceInfo `protobuf:"bytes,7,rep,name=child_calls,json=childCalls" json:"child_calls,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
-	XXX_unrecognized     []byte       `json:"-"`
-	XXX_sizecache        int32        `json:"-"`
+	ReceivedTime *int64       `protobuf:"varint,1,req,name=received_time,json=receivedTime" json:"received_time,omitempty"`
+	RepliedTime  *int64       `protobuf:"varint,2,req,name=replied_time,json=repliedTime" json:"replied_time,omitempty"`
+	MachineName  *string      `protobuf:"bytes,3,opt,name=machine_name,json=machineName" json:"machine_name,omitempty"`
+	EndpointName *string      `protobuf:"bytes,4,opt,name=endpoint_name,json=endpointName" json:"endpoint_name,omitempty"`
+	ErrorMessage *string      `protobuf:"bytes,5,opt,name=error_message,json=errorMessage" json:"error_message,omitempty"`
+	Redirect     *string      `protobuf:"bytes,6,opt,name=redirect" json:"redirect,omitempty"`
+	ChildCalls   []*TraceInfo `protobuf:"bytes,7,rep,name=child_calls,json=childCalls" json:"child_calls,omitempty"`
+	// µs the request waited in the server's queue before being handled
+	QueueTime            *int64   `protobuf:"varint,8,opt,name=queue_time,json=queueTime" json:"queue_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *TraceInfo) Reset()         { *m = TraceInfo{} }
@@ -137,7 +151,7 @@ func (m *TraceInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 		return xxx_messageInfo_TraceInfo.Marshal(b, m, deterministic)
 	} else {
 		b = b[:cap(b)]
-		n, err := m.MarshalTo(b)
+		n, err := m.MarshalToSizedBuffer(b)
 		if err != nil {
 			return nil, err
 		}
@@ -205,16 +219,105 @@ func (m *TraceInfo) GetChildCalls() []*TraceInfo {
 	return nil
 }
 
+func (m *TraceInfo) GetQueueTime() int64 {
+	if m != nil && m.QueueTime != nil {
+		return *m.QueueTime
+	}
+	return 0
+}
+
+// An entry of request or response metadata
+type KeyValue struct {
+	Key                  *string  `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Value                *string  `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KeyValue) Reset()         { *m = KeyValue{} }
+func (m *KeyValue) String() string { return proto.CompactTextString(m) }
+func (*KeyValue) ProtoMessage()    {}
+func (*KeyValue) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d74a5129edc93dca, []int{1}
+}
+func (m *KeyValue) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *KeyValue) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_KeyValue.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *KeyValue) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KeyValue.Merge(m, src)
+}
+func (m *KeyValue) XXX_Size() int {
+	return m.Size()
+}
+func (m *KeyValue) XXX_DiscardUnknown() {
+	xxx_messageInfo_KeyValue.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KeyValue proto.InternalMessageInfo
+
+func (m *KeyValue) GetKey() string {
+	if m != nil && m.Key != nil {
+		return *m.Key
+	}
+	return ""
+}
+
+func (m *KeyValue) GetValue() string {
+	if m != nil && m.Value != nil {
+		return *m.Value
+	}
+	return ""
+}
+
 type RPCRequest struct {
 	// A unique-ish ID for this RPC
 	RpcId     *string `protobuf:"bytes,1,opt,name=rpc_id,json=rpcId" json:"rpc_id,omitempty"`
 	Srvc      *string `protobuf:"bytes,2,req,name=srvc" json:"srvc,omitempty"`
 	Procedure *string `protobuf:"bytes,3,req,name=procedure" json:"procedure,omitempty"`
 	Data      []byte  `protobuf:"bytes,4,req,name=data" json:"data,omitempty"`
+	// Deprecated, use timeout_budget: UNIX µs timestamp after which we don't want to have an
+	// answer anymore (i.e. the server doesn't need to bother sending one). Depends on synchronized clocks.
 	Deadline  *int64  `protobuf:"varint,5,opt,name=deadline" json:"deadline,omitempty"`
-	// (i.e. the server doesn't need to bother sending one)
-	CallerId             *string  `protobuf:"bytes,6,opt,name=caller_id,json=callerId" json:"caller_id,omitempty"`
-	WantTrace            *bool    `protobuf:"varint,7,opt,name=want_trace,json=wantTrace" json:"want_trace,omitempty"`
+	CallerId  *string `protobuf:"bytes,6,opt,name=caller_id,json=callerId" json:"caller_id,omitempty"`
+	WantTrace *bool   `protobuf:"varint,7,opt,name=want_trace,json=wantTrace" json:"want_trace,omitempty"`
+	// The caller doesn't wait for a response; none is sent
+	OneWay *bool `protobuf:"varint,8,opt,name=one_way,json=oneWay" json:"one_way,omitempty"`
+	// Set on all messages belonging to a stream; chosen by the client
+	StreamId *string `protobuf:"bytes,9,opt,name=stream_id,json=streamId" json:"stream_id,omitempty"`
+	// Number of further stream responses the client is willing to receive (flow control)
+	StreamCredit *uint32 `protobuf:"varint,10,opt,name=stream_credit,json=streamCredit" json:"stream_credit,omitempty"`
+	// Set on all messages the client sends on a stream after the opening request
+	StreamMessage *bool `protobuf:"varint,11,opt,name=stream_message,json=streamMessage" json:"stream_message,omitempty"`
+	// The client won't send further messages on this stream
+	StreamHalfClose *bool `protobuf:"varint,12,opt,name=stream_half_close,json=streamHalfClose" json:"stream_half_close,omitempty"`
+	// The client abandons the stream
+	StreamCancel *bool `protobuf:"varint,13,opt,name=stream_cancel,json=streamCancel" json:"stream_cancel,omitempty"`
+	// Codec data is compressed with (see package compression); empty if uncompressed
+	Compression *string `protobuf:"bytes,14,opt,name=compression" json:"compression,omitempty"`
+	// Codec the client accepts for compressed responses
+	AcceptCompression *string `protobuf:"bytes,15,opt,name=accept_compression,json=acceptCompression" json:"accept_compression,omitempty"`
+	// Application-defined headers, e.g. auth tokens or locales
+	Metadata []*KeyValue `protobuf:"bytes,16,rep,name=metadata" json:"metadata,omitempty"`
+	// µs the caller waits for a response, counted from sending the request. The server
+	// discards the request when this time has passed before it could be handled.
+	TimeoutBudget *int64 `protobuf:"varint,17,opt,name=timeout_budget,json=timeoutBudget" json:"timeout_budget,omitempty"`
+	// µs the request waited in the load balancer queue; set by the server, ignored if sent by clients
+	QueueTime *int64 `protobuf:"varint,18,opt,name=queue_time,json=queueTime" json:"queue_time,omitempty"`
+	// 0 (lowest) to 3 (highest); higher priority requests are served first when the server is busy
+	Priority             *uint32  `protobuf:"varint,19,opt,name=priority,def=1" json:"priority,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -224,7 +327,7 @@ func (m *RPCRequest) Reset()         { *m = RPCRequest{} }
 func (m *RPCRequest) String() string { return proto.CompactTextString(m) }
 func (*RPCRequest) ProtoMessage()    {}
 func (*RPCRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d74a5129edc93dca, []int{1}
+	return fileDescriptor_d74a5129edc93dca, []int{2}
 }
 func (m *RPCRequest) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -234,7 +337,7 @@ func (m *RPCRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 		return xxx_messageInfo_RPCRequest.Marshal(b, m, deterministic)
 	} else {
 		b = b[:cap(b)]
-		n, err := m.MarshalTo(b)
+		n, err := m.MarshalToSizedBuffer(b)
 		if err != nil {
 			return nil, err
 		}
@@ -253,6 +356,8 @@ func (m *RPCRequest) XXX_DiscardUnknown() {
 
 var xxx_messageInfo_RPCRequest proto.InternalMessageInfo
 
+const Default_RPCRequest_Priority uint32 = 1
+
 func (m *RPCRequest) GetRpcId() string {
 	if m != nil && m.RpcId != nil {
 		return *m.RpcId
@@ -302,22 +407,118 @@ func (m *RPCRequest) GetWantTrace() bool {
 	return false
 }
 
+func (m *RPCRequest) GetOneWay() bool {
+	if m != nil && m.OneWay != nil {
+		return *m.OneWay
+	}
+	return false
+}
+
+func (m *RPCRequest) GetStreamId() string {
+	if m != nil && m.StreamId != nil {
+		return *m.StreamId
+	}
+	return ""
+}
+
+func (m *RPCRequest) GetStreamCredit() uint32 {
+	if m != nil && m.StreamCredit != nil {
+		return *m.StreamCredit
+	}
+	return 0
+}
+
+func (m *RPCRequest) GetStreamMessage() bool {
+	if m != nil && m.StreamMessage != nil {
+		return *m.StreamMessage
+	}
+	return false
+}
+
+func (m *RPCRequest) GetStreamHalfClose() bool {
+	if m != nil && m.StreamHalfClose != nil {
+		return *m.StreamHalfClose
+	}
+	return false
+}
+
+func (m *RPCRequest) GetStreamCancel() bool {
+	if m != nil && m.StreamCancel != nil {
+		return *m.StreamCancel
+	}
+	return false
+}
+
+func (m *RPCRequest) GetCompression() string {
+	if m != nil && m.Compression != nil {
+		return *m.Compression
+	}
+	return ""
+}
+
+func (m *RPCRequest) GetAcceptCompression() string {
+	if m != nil && m.AcceptCompression != nil {
+		return *m.AcceptCompression
+	}
+	return ""
+}
+
+func (m *RPCRequest) GetMetadata() []*KeyValue {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *RPCRequest) GetTimeoutBudget() int64 {
+	if m != nil && m.TimeoutBudget != nil {
+		return *m.TimeoutBudget
+	}
+	return 0
+}
+
+func (m *RPCRequest) GetQueueTime() int64 {
+	if m != nil && m.QueueTime != nil {
+		return *m.QueueTime
+	}
+	return 0
+}
+
+func (m *RPCRequest) GetPriority() uint32 {
+	if m != nil && m.Priority != nil {
+		return *m.Priority
+	}
+	return Default_RPCRequest_Priority
+}
+
 type RPCResponse struct {
-	RpcId                *string             `protobuf:"bytes,1,opt,name=rpc_id,json=rpcId" json:"rpc_id,omitempty"`
-	ResponseData         []byte              `protobuf:"bytes,2,opt,name=response_data,json=responseData" json:"response_data,omitempty"`
-	ResponseStatus       *RPCResponse_Status `protobuf:"varint,3,req,name=response_status,json=responseStatus,enum=proto.RPCResponse_Status" json:"response_status,omitempty"`
-	ErrorMessage         *string             `protobuf:"bytes,4,opt,name=error_message,json=errorMessage" json:"error_message,omitempty"`
-	Traceinfo            *TraceInfo          `protobuf:"bytes,5,opt,name=traceinfo" json:"traceinfo,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
-	XXX_unrecognized     []byte              `json:"-"`
-	XXX_sizecache        int32               `json:"-"`
+	RpcId          *string             `protobuf:"bytes,1,opt,name=rpc_id,json=rpcId" json:"rpc_id,omitempty"`
+	ResponseData   []byte              `protobuf:"bytes,2,opt,name=response_data,json=responseData" json:"response_data,omitempty"`
+	ResponseStatus *RPCResponse_Status `protobuf:"varint,3,req,name=response_status,json=responseStatus,enum=proto.RPCResponse_Status" json:"response_status,omitempty"`
+	ErrorMessage   *string             `protobuf:"bytes,4,opt,name=error_message,json=errorMessage" json:"error_message,omitempty"`
+	Traceinfo      *TraceInfo          `protobuf:"bytes,5,opt,name=traceinfo" json:"traceinfo,omitempty"`
+	// Position of this response in a stream, counting from 0
+	StreamSeq *uint64 `protobuf:"varint,6,opt,name=stream_seq,json=streamSeq" json:"stream_seq,omitempty"`
+	// More responses follow on this stream; the final one has the status of the stream
+	StreamMore *bool `protobuf:"varint,7,opt,name=stream_more,json=streamMore" json:"stream_more,omitempty"`
+	// Number of further messages the client may send on a stream (flow control). Responses
+	// granting credit carry no data and don't count as stream responses.
+	StreamCredit *uint32 `protobuf:"varint,8,opt,name=stream_credit,json=streamCredit" json:"stream_credit,omitempty"`
+	// Codec response_data is compressed with; empty if uncompressed
+	Compression *string     `protobuf:"bytes,9,opt,name=compression" json:"compression,omitempty"`
+	Metadata    []*KeyValue `protobuf:"bytes,10,rep,name=metadata" json:"metadata,omitempty"`
+	// With STATUS_OVERLOADED_RETRY: µs the client should wait before retrying
+	RetryAfter           *int64   `protobuf:"varint,11,opt,name=retry_after,json=retryAfter" json:"retry_after,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
 func (m *RPCResponse) Reset()         { *m = RPCResponse{} }
 func (m *RPCResponse) String() string { return proto.CompactTextString(m) }
 func (*RPCResponse) ProtoMessage()    {}
 func (*RPCResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_d74a5129edc93dca, []int{2}
+	return fileDescriptor_d74a5129edc93dca, []int{3}
 }
 func (m *RPCResponse) XXX_Unmarshal(b []byte) error {
 	return m.Unmarshal(b)
@@ -327,7 +528,7 @@ func (m *RPCResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error)
 		return xxx_messageInfo_RPCResponse.Marshal(b, m, deterministic)
 	} else {
 		b = b[:cap(b)]
-		n, err := m.MarshalTo(b)
+		n, err := m.MarshalToSizedBuffer(b)
 		if err != nil {
 			return nil, err
 		}
@@ -381,62 +582,208 @@ func (m *RPCResponse) GetTraceinfo() *TraceInfo {
 	return nil
 }
 
+func (m *RPCResponse) GetStreamSeq() uint64 {
+	if m != nil && m.StreamSeq != nil {
+		return *m.StreamSeq
+	}
+	return 0
+}
+
+func (m *RPCResponse) GetStreamMore() bool {
+	if m != nil && m.StreamMore != nil {
+		return *m.StreamMore
+	}
+	return false
+}
+
+func (m *RPCResponse) GetStreamCredit() uint32 {
+	if m != nil && m.StreamCredit != nil {
+		return *m.StreamCredit
+	}
+	return 0
+}
+
+func (m *RPCResponse) GetCompression() string {
+	if m != nil && m.Compression != nil {
+		return *m.Compression
+	}
+	return ""
+}
+
+func (m *RPCResponse) GetMetadata() []*KeyValue {
+	if m != nil {
+		return m.Metadata
+	}
+	return nil
+}
+
+func (m *RPCResponse) GetRetryAfter() int64 {
+	if m != nil && m.RetryAfter != nil {
+		return *m.RetryAfter
+	}
+	return 0
+}
+
+// Envelope of messages sent by a Publisher. The topic is also sent in a separate frame
+// before the envelope, for prefix filtering by SUB sockets.
+type PubSubMessage struct {
+	Topic *string `protobuf:"bytes,1,req,name=topic" json:"topic,omitempty"`
+	// Per topic, starting at 1; used by subscribers to detect lost messages
+	Sequence *uint64 `protobuf:"varint,2,req,name=sequence" json:"sequence,omitempty"`
+	Data     []byte  `protobuf:"bytes,3,opt,name=data" json:"data,omitempty"`
+	// UNIX µs timestamp of publication
+	PublishedTime        *int64   `protobuf:"varint,4,opt,name=published_time,json=publishedTime" json:"published_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PubSubMessage) Reset()         { *m = PubSubMessage{} }
+func (m *PubSubMessage) String() string { return proto.CompactTextString(m) }
+func (*PubSubMessage) ProtoMessage()    {}
+func (*PubSubMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_d74a5129edc93dca, []int{4}
+}
+func (m *PubSubMessage) XXX_Unmarshal(b []byte) error {
+	return m.Unmarshal(b)
+}
+func (m *PubSubMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	if deterministic {
+		return xxx_messageInfo_PubSubMessage.Marshal(b, m, deterministic)
+	} else {
+		b = b[:cap(b)]
+		n, err := m.MarshalToSizedBuffer(b)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
+func (m *PubSubMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PubSubMessage.Merge(m, src)
+}
+func (m *PubSubMessage) XXX_Size() int {
+	return m.Size()
+}
+func (m *PubSubMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_PubSubMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PubSubMessage proto.InternalMessageInfo
+
+func (m *PubSubMessage) GetTopic() string {
+	if m != nil && m.Topic != nil {
+		return *m.Topic
+	}
+	return ""
+}
+
+func (m *PubSubMessage) GetSequence() uint64 {
+	if m != nil && m.Sequence != nil {
+		return *m.Sequence
+	}
+	return 0
+}
+
+func (m *PubSubMessage) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *PubSubMessage) GetPublishedTime() int64 {
+	if m != nil && m.PublishedTime != nil {
+		return *m.PublishedTime
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterEnum("proto.RPCResponse_Status", RPCResponse_Status_name, RPCResponse_Status_value)
 	proto.RegisterType((*TraceInfo)(nil), "proto.TraceInfo")
+	proto.RegisterType((*KeyValue)(nil), "proto.KeyValue")
 	proto.RegisterType((*RPCRequest)(nil), "proto.RPCRequest")
 	proto.RegisterType((*RPCResponse)(nil), "proto.RPCResponse")
+	proto.RegisterType((*PubSubMessage)(nil), "proto.PubSubMessage")
 }
 
 func init() { proto.RegisterFile("proto/rpc.proto", fileDescriptor_d74a5129edc93dca) }
 
 var fileDescriptor_d74a5129edc93dca = []byte{
-	// 621 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x91, 0x4f, 0x72, 0xd3, 0x4a,
-	0x10, 0xc6, 0x9f, 0xe4, 0x3f, 0x89, 0xda, 0xb2, 0xa3, 0x37, 0x79, 0x8f, 0x88, 0x04, 0x8c, 0x31,
-	0x1b, 0xaf, 0x4c, 0x91, 0x1b, 0x38, 0xd6, 0x40, 0x54, 0x76, 0x24, 0x18, 0xc9, 0x49, 0x65, 0x35,
-	0xa5, 0x92, 0x26, 0x44, 0x55, 0xb6, 0x24, 0x46, 0x4a, 0x38, 0x06, 0x17, 0xe1, 0x12, 0xac, 0x60,
-	0xc9, 0x11, 0xa8, 0x9c, 0x84, 0x9a, 0xd1, 0xd8, 0x31, 0x95, 0xb0, 0xd2, 0xf4, 0xd7, 0x3f, 0x75,
-	0xf7, 0xd7, 0x0d, 0x7b, 0x05, 0xcf, 0xab, 0xfc, 0x35, 0x2f, 0xe2, 0xb1, 0x7c, 0xa1, 0x96, 0xfc,
-	0x0c, 0xbf, 0xe8, 0x60, 0x84, 0x3c, 0x8a, 0x99, 0x9b, 0x5d, 0xe5, 0xe8, 0x15, 0x74, 0x39, 0x8b,
-	0x59, 0x7a, 0xcb, 0x12, 0x5a, 0xa5, 0x2b, 0x66, 0x6b, 0x03, 0x7d, 0xd4, 0x20, 0xe6, 0x5a, 0x0c,
-	0xd3, 0x15, 0x43, 0x2f, 0xc1, 0xe4, 0xac, 0x58, 0xa6, 0x6b, 0x46, 0x97, 0x4c, 0x47, 0x69, 0x6b,
-	0x64, 0x15, 0xc5, 0xd7, 0x69, 0xc6, 0x68, 0x16, 0xad, 0x98, 0xdd, 0x18, 0x68, 0x23, 0x83, 0x74,
-	0x94, 0xe6, 0x45, 0x2b, 0x26, 0x5a, 0xb1, 0x2c, 0x29, 0xf2, 0x34, 0xab, 0x6a, 0xa6, 0x29, 0x19,
-	0x73, 0x2d, 0x6e, 0x20, 0xce, 0x73, 0x4e, 0x57, 0xac, 0x2c, 0xa3, 0x8f, 0xcc, 0x6e, 0x29, 0x48,
-	0x88, 0x67, 0xb5, 0x86, 0x0e, 0x61, 0x97, 0xb3, 0x24, 0xe5, 0x2c, 0xae, 0xec, 0xb6, 0xcc, 0x6f,
-	0x62, 0xf4, 0x06, 0x3a, 0xf1, 0x75, 0xba, 0x4c, 0x68, 0x1c, 0x2d, 0x97, 0xa5, 0xbd, 0x33, 0x68,
-	0x8c, 0x3a, 0xc7, 0x56, 0xbd, 0x82, 0xf1, 0xc6, 0x37, 0x01, 0x09, 0x4d, 0x05, 0x33, 0xfc, 0xa6,
-	0x01, 0x90, 0xf7, 0x53, 0xc2, 0x3e, 0xdd, 0xb0, 0xb2, 0x42, 0xff, 0x43, 0x9b, 0x17, 0x31, 0x4d,
-	0x13, 0x5b, 0x93, 0xb5, 0x5b, 0xbc, 0x88, 0xdd, 0x04, 0x21, 0x68, 0x96, 0xfc, 0x36, 0x96, 0xe6,
-	0x0d, 0x22, 0xdf, 0xe8, 0x19, 0x18, 0x05, 0xcf, 0x63, 0x96, 0xdc, 0x70, 0x61, 0x59, 0x24, 0xee,
-	0x05, 0xf1, 0x47, 0x12, 0x55, 0x91, 0xdd, 0x1c, 0xe8, 0x23, 0x93, 0xc8, 0xb7, 0x18, 0x3d, 0x61,
-	0x51, 0xb2, 0x4c, 0xb3, 0xda, 0x5a, 0x83, 0x6c, 0x62, 0x74, 0x04, 0x86, 0x18, 0x9a, 0x71, 0xd1,
-	0x5b, 0xf9, 0xaa, 0x05, 0x37, 0x41, 0xcf, 0x01, 0x3e, 0x47, 0x59, 0x45, 0x2b, 0x61, 0xc1, 0xde,
-	0x19, 0x68, 0xa3, 0x5d, 0x62, 0x08, 0x45, 0x7a, 0x1a, 0x7e, 0x6d, 0x42, 0x47, 0x7a, 0x28, 0x8b,
-	0x3c, 0x2b, 0xd9, 0xdf, 0x4c, 0xc8, 0x73, 0xd7, 0x08, 0x95, 0xb3, 0xe9, 0x03, 0x6d, 0x64, 0x8a,
-	0x73, 0xd7, 0xa2, 0x23, 0x66, 0x3c, 0x81, 0xbd, 0x0d, 0x54, 0x56, 0x51, 0x75, 0x53, 0x4a, 0x6f,
-	0xbd, 0xe3, 0xa7, 0x6a, 0x8d, 0x5b, 0x8d, 0xc6, 0x81, 0x04, 0x48, 0x6f, 0xfd, 0x47, 0x1d, 0x3f,
-	0xbc, 0x63, 0xf3, 0x91, 0x3b, 0x8e, 0xc1, 0x90, 0x76, 0xd2, 0xec, 0x2a, 0x97, 0xdb, 0x78, 0xec,
-	0x52, 0xf7, 0xc8, 0xf0, 0xbb, 0x0e, 0x6d, 0x55, 0x1f, 0x41, 0x2f, 0x08, 0x27, 0xe1, 0x22, 0xa0,
-	0x0b, 0x6f, 0xe6, 0xf9, 0x17, 0x9e, 0xf5, 0x0f, 0xea, 0x82, 0xa1, 0x34, 0x7f, 0x66, 0x69, 0xe8,
-	0x3f, 0xb0, 0x54, 0xe8, 0xf9, 0x21, 0x7d, 0xeb, 0x2f, 0x3c, 0xc7, 0xd2, 0xd1, 0xbf, 0xd0, 0xdd,
-	0x52, 0xfd, 0x99, 0xd5, 0x44, 0x07, 0xb0, 0xaf, 0xa4, 0x00, 0x93, 0x73, 0x4c, 0x28, 0x26, 0xc4,
-	0x27, 0x56, 0x6b, 0xab, 0x49, 0xe8, 0x9e, 0x61, 0x7f, 0x11, 0x5a, 0x6d, 0x74, 0x04, 0x07, 0xeb,
-	0x26, 0xe7, 0x98, 0xcc, 0xfd, 0x89, 0x83, 0x1d, 0x4a, 0x70, 0x48, 0x2e, 0xad, 0x1d, 0xf4, 0x02,
-	0x8e, 0x54, 0x72, 0x3a, 0x77, 0xb1, 0x17, 0x52, 0x82, 0x3f, 0x2c, 0x70, 0x10, 0xaa, 0x8a, 0xc6,
-	0x43, 0xc0, 0xc3, 0xe1, 0x85, 0x4f, 0x66, 0x0a, 0x00, 0xd4, 0x87, 0xc3, 0x3f, 0x81, 0xe9, 0x64,
-	0x3e, 0xc7, 0x0e, 0xbd, 0x20, 0xbe, 0xf7, 0xce, 0xea, 0xa0, 0x43, 0x78, 0xa2, 0xf2, 0x67, 0x6e,
-	0x10, 0x60, 0x87, 0x3a, 0x78, 0xe2, 0xcc, 0x5d, 0x0f, 0x5b, 0x26, 0xda, 0x87, 0x3d, 0x95, 0x13,
-	0x63, 0x05, 0xa7, 0xd8, 0xb1, 0xba, 0x5b, 0x5b, 0x58, 0x78, 0xa7, 0x78, 0x32, 0x0f, 0x4f, 0x2f,
-	0xad, 0xde, 0x89, 0xf9, 0xe3, 0xae, 0xaf, 0xfd, 0xbc, 0xeb, 0x6b, 0xbf, 0xee, 0xfa, 0xda, 0xef,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x33, 0xf7, 0x85, 0xb7, 0x2b, 0x04, 0x00, 0x00,
+	// 1045 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x55, 0xcd, 0x6e, 0xe3, 0x36,
+	0x17, 0xfd, 0x64, 0x3b, 0x8e, 0x75, 0xfd, 0xa7, 0x70, 0x32, 0xdf, 0x68, 0x92, 0x4e, 0xe2, 0xba,
+	0x28, 0x60, 0xb4, 0x68, 0x8a, 0xc9, 0xb2, 0x3b, 0xc7, 0x62, 0x1b, 0x23, 0x8e, 0x94, 0xa1, 0xe4,
+	0xa4, 0xb3, 0x12, 0x14, 0x89, 0x99, 0x08, 0x95, 0x25, 0x85, 0x92, 0x32, 0x30, 0xd0, 0x87, 0xe9,
+	0x13, 0xf4, 0x39, 0xba, 0xec, 0xba, 0xab, 0x22, 0x2f, 0xd1, 0x6d, 0x41, 0x8a, 0xd2, 0xb8, 0x49,
+	0x8a, 0xae, 0xc4, 0x7b, 0xee, 0x21, 0x2f, 0x79, 0xee, 0x21, 0x05, 0xc3, 0x94, 0x25, 0x79, 0xf2,
+	0x2d, 0x4b, 0xfd, 0x23, 0x31, 0x42, 0x5b, 0xe2, 0x33, 0xfe, 0xb5, 0x01, 0xaa, 0xc3, 0x3c, 0x9f,
+	0xce, 0xe3, 0x9b, 0x04, 0x7d, 0x01, 0x7d, 0x46, 0x7d, 0x1a, 0xde, 0xd3, 0xc0, 0xcd, 0xc3, 0x15,
+	0xd5, 0x95, 0x51, 0x63, 0xd2, 0x24, 0xbd, 0x0a, 0x74, 0xc2, 0x15, 0x45, 0x9f, 0x43, 0x8f, 0xd1,
+	0x34, 0x0a, 0x2b, 0x4e, 0x43, 0x70, 0xba, 0x12, 0xab, 0x28, 0x2b, 0xcf, 0xbf, 0x0d, 0x63, 0xea,
+	0xc6, 0xde, 0x8a, 0xea, 0xcd, 0x91, 0x32, 0x51, 0x49, 0x57, 0x62, 0xa6, 0xb7, 0xa2, 0xbc, 0x14,
+	0x8d, 0x83, 0x34, 0x09, 0xe3, 0xbc, 0xe4, 0xb4, 0x04, 0xa7, 0x57, 0x81, 0x35, 0x89, 0xb1, 0x84,
+	0xb9, 0x2b, 0x9a, 0x65, 0xde, 0x07, 0xaa, 0x6f, 0x49, 0x12, 0x07, 0xcf, 0x4b, 0x0c, 0xed, 0x41,
+	0x87, 0xd1, 0x20, 0x64, 0xd4, 0xcf, 0xf5, 0xb6, 0xc8, 0xd7, 0x31, 0x7a, 0x0b, 0x5d, 0xff, 0x36,
+	0x8c, 0x02, 0xd7, 0xf7, 0xa2, 0x28, 0xd3, 0xb7, 0x47, 0xcd, 0x49, 0xf7, 0x58, 0x2b, 0x25, 0x38,
+	0xaa, 0xcf, 0x4d, 0x40, 0x90, 0x66, 0x9c, 0x83, 0xde, 0x00, 0xdc, 0x15, 0xb4, 0xa0, 0xe5, 0xe1,
+	0x3a, 0x23, 0x65, 0xd2, 0x24, 0xaa, 0x40, 0xf8, 0xd1, 0xc6, 0xc7, 0xd0, 0x39, 0xa3, 0xeb, 0x4b,
+	0x2f, 0x2a, 0x28, 0xd2, 0xa0, 0xf9, 0x13, 0x5d, 0x0b, 0x91, 0x54, 0xc2, 0x87, 0x68, 0x17, 0xb6,
+	0xee, 0x79, 0x4a, 0x6f, 0x88, 0x8d, 0x94, 0xc1, 0xf8, 0xaf, 0x16, 0x00, 0xb9, 0x98, 0x11, 0x7a,
+	0x57, 0xd0, 0x2c, 0x47, 0x2f, 0xa1, 0xcd, 0x52, 0xdf, 0x0d, 0x03, 0x5d, 0x29, 0x59, 0x2c, 0xf5,
+	0xe7, 0x01, 0x42, 0xd0, 0xca, 0xd8, 0xbd, 0x2f, 0xf4, 0x54, 0x89, 0x18, 0xa3, 0xcf, 0x40, 0x4d,
+	0x59, 0xe2, 0xd3, 0xa0, 0x60, 0x5c, 0x45, 0x9e, 0xf8, 0x04, 0xf0, 0x19, 0x81, 0x97, 0x7b, 0x7a,
+	0x6b, 0xd4, 0x98, 0xf4, 0x88, 0x18, 0x73, 0x35, 0x02, 0xea, 0x05, 0x51, 0x18, 0x97, 0x6a, 0x35,
+	0x49, 0x1d, 0xa3, 0x7d, 0x50, 0xb9, 0x0e, 0x94, 0xf1, 0xda, 0x52, 0xaa, 0x12, 0x98, 0x07, 0xfc,
+	0xdc, 0x1f, 0xbd, 0x38, 0x77, 0x73, 0xae, 0x8a, 0xbe, 0x3d, 0x52, 0x26, 0x1d, 0xa2, 0x72, 0x44,
+	0xc8, 0x84, 0x5e, 0xc1, 0x76, 0x12, 0x53, 0xf7, 0xa3, 0xb7, 0x16, 0x9a, 0x74, 0x48, 0x3b, 0x89,
+	0xe9, 0x95, 0xb7, 0xe6, 0x8b, 0x66, 0x39, 0xa3, 0xde, 0x8a, 0x2f, 0xaa, 0x96, 0x8b, 0x96, 0xc0,
+	0x3c, 0xe0, 0x0d, 0x94, 0x49, 0x9f, 0xf7, 0x24, 0xd7, 0x61, 0xa4, 0x4c, 0xfa, 0xa4, 0x57, 0x82,
+	0x33, 0x81, 0xa1, 0x2f, 0x61, 0x20, 0x49, 0x55, 0x9b, 0xbb, 0xa2, 0x82, 0x9c, 0x5a, 0xf5, 0xf9,
+	0x2b, 0xd8, 0x91, 0xb4, 0x5b, 0x2f, 0xba, 0x71, 0xfd, 0x28, 0xc9, 0xa8, 0xde, 0x13, 0xcc, 0x61,
+	0x99, 0x38, 0xf5, 0xa2, 0x9b, 0x19, 0x87, 0x37, 0xeb, 0x7a, 0xb1, 0x4f, 0x23, 0xbd, 0x2f, 0x78,
+	0x55, 0x5d, 0x81, 0xa1, 0x11, 0x74, 0xfd, 0x64, 0x95, 0x32, 0x9a, 0x65, 0x61, 0x12, 0xeb, 0x83,
+	0xd2, 0xa4, 0x1b, 0x10, 0xfa, 0x06, 0x90, 0xe7, 0xfb, 0x34, 0xcd, 0xdd, 0x4d, 0xe2, 0x50, 0x10,
+	0x77, 0xca, 0xcc, 0x6c, 0x83, 0xfe, 0x35, 0x74, 0x56, 0x34, 0xf7, 0x44, 0x4f, 0x34, 0x61, 0xb5,
+	0xa1, 0xb4, 0x5a, 0x65, 0x19, 0x52, 0x13, 0xf8, 0xa9, 0xb9, 0xc3, 0x92, 0x22, 0x77, 0xaf, 0x8b,
+	0xe0, 0x03, 0xcd, 0xf5, 0x1d, 0xd1, 0xae, 0xbe, 0x44, 0x4f, 0x04, 0xf8, 0xc8, 0x8e, 0xe8, 0x91,
+	0x1d, 0xd1, 0x1b, 0xe8, 0xa4, 0x2c, 0x4c, 0x58, 0x98, 0xaf, 0xf5, 0x17, 0x5c, 0xdb, 0xef, 0x94,
+	0xb7, 0xa4, 0x86, 0xc6, 0x7f, 0xb4, 0xa1, 0x2b, 0x9c, 0x97, 0xa5, 0x49, 0x9c, 0xd1, 0x7f, 0xb3,
+	0x9e, 0xb8, 0xf7, 0x25, 0xc5, 0x15, 0xbb, 0xe7, 0xf6, 0xed, 0x91, 0x5e, 0x05, 0x1a, 0x7c, 0xc3,
+	0x27, 0x30, 0xac, 0x49, 0x59, 0xee, 0xe5, 0x45, 0x26, 0x1c, 0x39, 0x38, 0x7e, 0x2d, 0x0f, 0xb9,
+	0x51, 0xe8, 0xc8, 0x16, 0x04, 0x32, 0xa8, 0x66, 0x94, 0xf1, 0xd3, 0x0b, 0xdd, 0x7a, 0xe6, 0x42,
+	0x1f, 0x81, 0x2a, 0x4c, 0x18, 0xc6, 0x37, 0x89, 0xf0, 0xf0, 0x73, 0x57, 0xf6, 0x13, 0x85, 0x4b,
+	0x24, 0x9b, 0x9d, 0xd1, 0x3b, 0xe1, 0xeb, 0x16, 0x91, 0x9e, 0xb4, 0xe9, 0x1d, 0x3a, 0x84, 0xae,
+	0x4c, 0xaf, 0x12, 0x56, 0x39, 0x5b, 0xce, 0x38, 0x4f, 0x18, 0x7d, 0x6a, 0xd2, 0xce, 0x33, 0x26,
+	0x7d, 0x64, 0x16, 0xf5, 0xa9, 0x59, 0x36, 0xbb, 0x0f, 0xff, 0xd5, 0xfd, 0x43, 0xe8, 0x32, 0x9a,
+	0xb3, 0xb5, 0xeb, 0xdd, 0xe4, 0x94, 0x09, 0xc3, 0x37, 0x09, 0x08, 0x68, 0xca, 0x91, 0xf1, 0x2f,
+	0x4d, 0x68, 0x4b, 0xd1, 0x10, 0x0c, 0x6c, 0x67, 0xea, 0x2c, 0x6d, 0x77, 0x69, 0x9e, 0x99, 0xd6,
+	0x95, 0xa9, 0xfd, 0x0f, 0xf5, 0x41, 0x95, 0x98, 0x75, 0xa6, 0x29, 0x68, 0x17, 0x34, 0x19, 0x9a,
+	0x96, 0xe3, 0x7e, 0x6f, 0x2d, 0x4d, 0x43, 0x6b, 0xa0, 0x1d, 0xe8, 0x6f, 0xa0, 0xd6, 0x99, 0xd6,
+	0x42, 0xaf, 0xe0, 0x85, 0x84, 0x6c, 0x4c, 0x2e, 0x31, 0x71, 0x31, 0x21, 0x16, 0xd1, 0xb6, 0x36,
+	0x8a, 0x38, 0xf3, 0x73, 0x6c, 0x2d, 0x1d, 0xad, 0x8d, 0xf6, 0xe1, 0x55, 0x55, 0xe4, 0x12, 0x93,
+	0x85, 0x35, 0x35, 0xb0, 0xe1, 0x12, 0xec, 0x90, 0xf7, 0xda, 0x36, 0x3a, 0x84, 0x7d, 0x99, 0x9c,
+	0x2d, 0xe6, 0xd8, 0x74, 0x5c, 0x82, 0xdf, 0x2d, 0xb1, 0xed, 0xc8, 0x15, 0xd5, 0xa7, 0x04, 0x13,
+	0x3b, 0x57, 0x16, 0x39, 0x93, 0x04, 0x40, 0x07, 0xb0, 0xf7, 0x4f, 0xc2, 0x6c, 0xba, 0x58, 0x60,
+	0xc3, 0xbd, 0x22, 0x96, 0xf9, 0x83, 0xd6, 0x45, 0x7b, 0xf0, 0x7f, 0x99, 0x3f, 0x9f, 0xdb, 0x36,
+	0x36, 0x5c, 0x03, 0x4f, 0x8d, 0xc5, 0xdc, 0xc4, 0x5a, 0x0f, 0xbd, 0x80, 0xa1, 0xcc, 0xf1, 0x6d,
+	0xd9, 0xa7, 0xd8, 0xd0, 0xfa, 0x1b, 0x2a, 0x2c, 0xcd, 0x53, 0x3c, 0x5d, 0x38, 0xa7, 0xef, 0xb5,
+	0x01, 0x1a, 0xc3, 0x41, 0x8d, 0xda, 0xcb, 0x8b, 0x0b, 0x8b, 0x38, 0xd8, 0x70, 0x67, 0xd6, 0xf9,
+	0x05, 0xc1, 0xb6, 0x3d, 0xb7, 0x4c, 0x6d, 0x88, 0x5e, 0xc3, 0x4b, 0xc9, 0x79, 0xb7, 0xb4, 0x9c,
+	0xa9, 0x8b, 0x7f, 0x9c, 0x61, 0x6c, 0x60, 0x43, 0xd3, 0x90, 0x0e, 0xbb, 0x1b, 0x22, 0xd6, 0x0b,
+	0x68, 0x3b, 0xe3, 0x9f, 0xa1, 0x7f, 0x51, 0x5c, 0xdb, 0xc5, 0x75, 0x65, 0xdc, 0x5d, 0xd8, 0xca,
+	0x93, 0x34, 0xf4, 0xe5, 0x1f, 0xa1, 0x0c, 0xf8, 0x8b, 0x9c, 0xf1, 0x97, 0x3f, 0xf6, 0xcb, 0x7f,
+	0x65, 0x8b, 0xd4, 0x71, 0xfd, 0x82, 0x37, 0xc5, 0x7d, 0x6b, 0x55, 0x0f, 0x43, 0x5a, 0x5c, 0x47,
+	0x61, 0x76, 0x5b, 0xfd, 0x61, 0x5b, 0xe5, 0xc3, 0x50, 0xa3, 0xfc, 0xe6, 0x9f, 0xf4, 0x7e, 0x7b,
+	0x38, 0x50, 0x7e, 0x7f, 0x38, 0x50, 0xfe, 0x7c, 0x38, 0x50, 0xfe, 0x1e, 0x00, 0x0a, 0x30, 0x37,
+	0x50, 0xe0, 0x07, 0x00, 0x00,
 }
 
 func (m *TraceInfo) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
-	n, err := m.MarshalTo(dAtA)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
 	if err != nil {
 		return nil, err
 	}
@@ -444,142 +791,316 @@ func (m *TraceInfo) Marshal() (dAtA []byte, err error) {
 }
 
 func (m *TraceInfo) MarshalTo(dAtA []byte) (int, error) {
-	var i int
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *TraceInfo) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if m.ReceivedTime == nil {
-		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("received_time")
-	} else {
-		dAtA[i] = 0x8
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(*m.ReceivedTime))
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
 	}
-	if m.RepliedTime == nil {
-		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("replied_time")
-	} else {
-		dAtA[i] = 0x10
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(*m.RepliedTime))
+	if m.QueueTime != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.QueueTime))
+		i--
+		dAtA[i] = 0x40
 	}
-	if m.MachineName != nil {
-		dAtA[i] = 0x1a
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.MachineName)))
-		i += copy(dAtA[i:], *m.MachineName)
+	if len(m.ChildCalls) > 0 {
+		for iNdEx := len(m.ChildCalls) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.ChildCalls[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x3a
+		}
 	}
-	if m.EndpointName != nil {
-		dAtA[i] = 0x22
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.EndpointName)))
-		i += copy(dAtA[i:], *m.EndpointName)
+	if m.Redirect != nil {
+		i -= len(*m.Redirect)
+		copy(dAtA[i:], *m.Redirect)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Redirect)))
+		i--
+		dAtA[i] = 0x32
 	}
 	if m.ErrorMessage != nil {
-		dAtA[i] = 0x2a
-		i++
+		i -= len(*m.ErrorMessage)
+		copy(dAtA[i:], *m.ErrorMessage)
 		i = encodeVarintRpc(dAtA, i, uint64(len(*m.ErrorMessage)))
-		i += copy(dAtA[i:], *m.ErrorMessage)
+		i--
+		dAtA[i] = 0x2a
 	}
-	if m.Redirect != nil {
-		dAtA[i] = 0x32
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Redirect)))
-		i += copy(dAtA[i:], *m.Redirect)
+	if m.EndpointName != nil {
+		i -= len(*m.EndpointName)
+		copy(dAtA[i:], *m.EndpointName)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.EndpointName)))
+		i--
+		dAtA[i] = 0x22
 	}
-	if len(m.ChildCalls) > 0 {
-		for _, msg := range m.ChildCalls {
-			dAtA[i] = 0x3a
-			i++
-			i = encodeVarintRpc(dAtA, i, uint64(msg.Size()))
-			n, err := msg.MarshalTo(dAtA[i:])
-			if err != nil {
-				return 0, err
-			}
-			i += n
-		}
+	if m.MachineName != nil {
+		i -= len(*m.MachineName)
+		copy(dAtA[i:], *m.MachineName)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.MachineName)))
+		i--
+		dAtA[i] = 0x1a
 	}
-	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
+	if m.RepliedTime == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("replied_time")
+	} else {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.RepliedTime))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.ReceivedTime == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("received_time")
+	} else {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.ReceivedTime))
+		i--
+		dAtA[i] = 0x8
 	}
-	return i, nil
+	return len(dAtA) - i, nil
 }
 
-func (m *RPCRequest) Marshal() (dAtA []byte, err error) {
+func (m *KeyValue) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
-	n, err := m.MarshalTo(dAtA)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
 	if err != nil {
 		return nil, err
 	}
 	return dAtA[:n], nil
 }
 
-func (m *RPCRequest) MarshalTo(dAtA []byte) (int, error) {
-	var i int
+func (m *KeyValue) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *KeyValue) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if m.RpcId != nil {
-		dAtA[i] = 0xa
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.RpcId)))
-		i += copy(dAtA[i:], *m.RpcId)
-	}
-	if m.Srvc == nil {
-		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("srvc")
-	} else {
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Value != nil {
+		i -= len(*m.Value)
+		copy(dAtA[i:], *m.Value)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Value)))
+		i--
 		dAtA[i] = 0x12
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Srvc)))
-		i += copy(dAtA[i:], *m.Srvc)
-	}
-	if m.Procedure == nil {
-		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("procedure")
-	} else {
-		dAtA[i] = 0x1a
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Procedure)))
-		i += copy(dAtA[i:], *m.Procedure)
 	}
-	if m.Data == nil {
-		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("data")
+	if m.Key == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("key")
 	} else {
-		dAtA[i] = 0x22
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(m.Data)))
-		i += copy(dAtA[i:], m.Data)
+		i -= len(*m.Key)
+		copy(dAtA[i:], *m.Key)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Key)))
+		i--
+		dAtA[i] = 0xa
 	}
-	if m.Deadline != nil {
-		dAtA[i] = 0x28
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(*m.Deadline))
+	return len(dAtA) - i, nil
+}
+
+func (m *RPCRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
 	}
-	if m.CallerId != nil {
-		dAtA[i] = 0x32
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.CallerId)))
-		i += copy(dAtA[i:], *m.CallerId)
+	return dAtA[:n], nil
+}
+
+func (m *RPCRequest) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *RPCRequest) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.Priority != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Priority))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x98
+	}
+	if m.QueueTime != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.QueueTime))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x90
+	}
+	if m.TimeoutBudget != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.TimeoutBudget))
+		i--
+		dAtA[i] = 0x1
+		i--
+		dAtA[i] = 0x88
+	}
+	if len(m.Metadata) > 0 {
+		for iNdEx := len(m.Metadata) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Metadata[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x1
+			i--
+			dAtA[i] = 0x82
+		}
+	}
+	if m.AcceptCompression != nil {
+		i -= len(*m.AcceptCompression)
+		copy(dAtA[i:], *m.AcceptCompression)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.AcceptCompression)))
+		i--
+		dAtA[i] = 0x7a
+	}
+	if m.Compression != nil {
+		i -= len(*m.Compression)
+		copy(dAtA[i:], *m.Compression)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Compression)))
+		i--
+		dAtA[i] = 0x72
+	}
+	if m.StreamCancel != nil {
+		i--
+		if *m.StreamCancel {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x68
+	}
+	if m.StreamHalfClose != nil {
+		i--
+		if *m.StreamHalfClose {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x60
+	}
+	if m.StreamMessage != nil {
+		i--
+		if *m.StreamMessage {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x58
+	}
+	if m.StreamCredit != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.StreamCredit))
+		i--
+		dAtA[i] = 0x50
+	}
+	if m.StreamId != nil {
+		i -= len(*m.StreamId)
+		copy(dAtA[i:], *m.StreamId)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.StreamId)))
+		i--
+		dAtA[i] = 0x4a
+	}
+	if m.OneWay != nil {
+		i--
+		if *m.OneWay {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x40
 	}
 	if m.WantTrace != nil {
-		dAtA[i] = 0x38
-		i++
+		i--
 		if *m.WantTrace {
 			dAtA[i] = 1
 		} else {
 			dAtA[i] = 0
 		}
-		i++
+		i--
+		dAtA[i] = 0x38
 	}
-	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
+	if m.CallerId != nil {
+		i -= len(*m.CallerId)
+		copy(dAtA[i:], *m.CallerId)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.CallerId)))
+		i--
+		dAtA[i] = 0x32
+	}
+	if m.Deadline != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Deadline))
+		i--
+		dAtA[i] = 0x28
+	}
+	if m.Data == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("data")
+	} else {
+		i -= len(m.Data)
+		copy(dAtA[i:], m.Data)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Data)))
+		i--
+		dAtA[i] = 0x22
+	}
+	if m.Procedure == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("procedure")
+	} else {
+		i -= len(*m.Procedure)
+		copy(dAtA[i:], *m.Procedure)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Procedure)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if m.Srvc == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("srvc")
+	} else {
+		i -= len(*m.Srvc)
+		copy(dAtA[i:], *m.Srvc)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Srvc)))
+		i--
+		dAtA[i] = 0x12
 	}
-	return i, nil
+	if m.RpcId != nil {
+		i -= len(*m.RpcId)
+		copy(dAtA[i:], *m.RpcId)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.RpcId)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
 }
 
 func (m *RPCResponse) Marshal() (dAtA []byte, err error) {
 	size := m.Size()
 	dAtA = make([]byte, size)
-	n, err := m.MarshalTo(dAtA)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
 	if err != nil {
 		return nil, err
 	}
@@ -587,59 +1108,173 @@ func (m *RPCResponse) Marshal() (dAtA []byte, err error) {
 }
 
 func (m *RPCResponse) MarshalTo(dAtA []byte) (int, error) {
-	var i int
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *RPCResponse) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
 	_ = i
 	var l int
 	_ = l
-	if m.RpcId != nil {
-		dAtA[i] = 0xa
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.RpcId)))
-		i += copy(dAtA[i:], *m.RpcId)
+	if m.XXX_unrecognized != nil {
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.RetryAfter != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.RetryAfter))
+		i--
+		dAtA[i] = 0x58
+	}
+	if len(m.Metadata) > 0 {
+		for iNdEx := len(m.Metadata) - 1; iNdEx >= 0; iNdEx-- {
+			{
+				size, err := m.Metadata[iNdEx].MarshalToSizedBuffer(dAtA[:i])
+				if err != nil {
+					return 0, err
+				}
+				i -= size
+				i = encodeVarintRpc(dAtA, i, uint64(size))
+			}
+			i--
+			dAtA[i] = 0x52
+		}
 	}
-	if m.ResponseData != nil {
-		dAtA[i] = 0x12
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(m.ResponseData)))
-		i += copy(dAtA[i:], m.ResponseData)
+	if m.Compression != nil {
+		i -= len(*m.Compression)
+		copy(dAtA[i:], *m.Compression)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Compression)))
+		i--
+		dAtA[i] = 0x4a
+	}
+	if m.StreamCredit != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.StreamCredit))
+		i--
+		dAtA[i] = 0x40
+	}
+	if m.StreamMore != nil {
+		i--
+		if *m.StreamMore {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x38
+	}
+	if m.StreamSeq != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.StreamSeq))
+		i--
+		dAtA[i] = 0x30
+	}
+	if m.Traceinfo != nil {
+		{
+			size, err := m.Traceinfo.MarshalToSizedBuffer(dAtA[:i])
+			if err != nil {
+				return 0, err
+			}
+			i -= size
+			i = encodeVarintRpc(dAtA, i, uint64(size))
+		}
+		i--
+		dAtA[i] = 0x2a
+	}
+	if m.ErrorMessage != nil {
+		i -= len(*m.ErrorMessage)
+		copy(dAtA[i:], *m.ErrorMessage)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.ErrorMessage)))
+		i--
+		dAtA[i] = 0x22
 	}
 	if m.ResponseStatus == nil {
 		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("response_status")
 	} else {
-		dAtA[i] = 0x18
-		i++
 		i = encodeVarintRpc(dAtA, i, uint64(*m.ResponseStatus))
+		i--
+		dAtA[i] = 0x18
 	}
-	if m.ErrorMessage != nil {
-		dAtA[i] = 0x22
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(len(*m.ErrorMessage)))
-		i += copy(dAtA[i:], *m.ErrorMessage)
+	if m.ResponseData != nil {
+		i -= len(m.ResponseData)
+		copy(dAtA[i:], m.ResponseData)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.ResponseData)))
+		i--
+		dAtA[i] = 0x12
 	}
-	if m.Traceinfo != nil {
-		dAtA[i] = 0x2a
-		i++
-		i = encodeVarintRpc(dAtA, i, uint64(m.Traceinfo.Size()))
-		n1, err1 := m.Traceinfo.MarshalTo(dAtA[i:])
-		if err1 != nil {
-			return 0, err1
-		}
-		i += n1
+	if m.RpcId != nil {
+		i -= len(*m.RpcId)
+		copy(dAtA[i:], *m.RpcId)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.RpcId)))
+		i--
+		dAtA[i] = 0xa
+	}
+	return len(dAtA) - i, nil
+}
+
+func (m *PubSubMessage) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalToSizedBuffer(dAtA[:size])
+	if err != nil {
+		return nil, err
 	}
+	return dAtA[:n], nil
+}
+
+func (m *PubSubMessage) MarshalTo(dAtA []byte) (int, error) {
+	size := m.Size()
+	return m.MarshalToSizedBuffer(dAtA[:size])
+}
+
+func (m *PubSubMessage) MarshalToSizedBuffer(dAtA []byte) (int, error) {
+	i := len(dAtA)
+	_ = i
+	var l int
+	_ = l
 	if m.XXX_unrecognized != nil {
-		i += copy(dAtA[i:], m.XXX_unrecognized)
+		i -= len(m.XXX_unrecognized)
+		copy(dAtA[i:], m.XXX_unrecognized)
+	}
+	if m.PublishedTime != nil {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.PublishedTime))
+		i--
+		dAtA[i] = 0x20
+	}
+	if m.Data != nil {
+		i -= len(m.Data)
+		copy(dAtA[i:], m.Data)
+		i = encodeVarintRpc(dAtA, i, uint64(len(m.Data)))
+		i--
+		dAtA[i] = 0x1a
+	}
+	if m.Sequence == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("sequence")
+	} else {
+		i = encodeVarintRpc(dAtA, i, uint64(*m.Sequence))
+		i--
+		dAtA[i] = 0x10
+	}
+	if m.Topic == nil {
+		return 0, github_com_gogo_protobuf_proto.NewRequiredNotSetError("topic")
+	} else {
+		i -= len(*m.Topic)
+		copy(dAtA[i:], *m.Topic)
+		i = encodeVarintRpc(dAtA, i, uint64(len(*m.Topic)))
+		i--
+		dAtA[i] = 0xa
 	}
-	return i, nil
+	return len(dAtA) - i, nil
 }
 
 func encodeVarintRpc(dAtA []byte, offset int, v uint64) int {
+	offset -= sovRpc(v)
+	base := offset
 	for v >= 1<<7 {
 		dAtA[offset] = uint8(v&0x7f | 0x80)
 		v >>= 7
 		offset++
 	}
 	dAtA[offset] = uint8(v)
-	return offset + 1
+	return base
 }
 func (m *TraceInfo) Size() (n int) {
 	if m == nil {
@@ -675,6 +1310,29 @@ func (m *TraceInfo) Size() (n int) {
 			n += 1 + l + sovRpc(uint64(l))
 		}
 	}
+	if m.QueueTime != nil {
+		n += 1 + sovRpc(uint64(*m.QueueTime))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *KeyValue) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Key != nil {
+		l = len(*m.Key)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.Value != nil {
+		l = len(*m.Value)
+		n += 1 + l + sovRpc(uint64(l))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -713,6 +1371,48 @@ func (m *RPCRequest) Size() (n int) {
 	if m.WantTrace != nil {
 		n += 2
 	}
+	if m.OneWay != nil {
+		n += 2
+	}
+	if m.StreamId != nil {
+		l = len(*m.StreamId)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.StreamCredit != nil {
+		n += 1 + sovRpc(uint64(*m.StreamCredit))
+	}
+	if m.StreamMessage != nil {
+		n += 2
+	}
+	if m.StreamHalfClose != nil {
+		n += 2
+	}
+	if m.StreamCancel != nil {
+		n += 2
+	}
+	if m.Compression != nil {
+		l = len(*m.Compression)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.AcceptCompression != nil {
+		l = len(*m.AcceptCompression)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if len(m.Metadata) > 0 {
+		for _, e := range m.Metadata {
+			l = e.Size()
+			n += 2 + l + sovRpc(uint64(l))
+		}
+	}
+	if m.TimeoutBudget != nil {
+		n += 2 + sovRpc(uint64(*m.TimeoutBudget))
+	}
+	if m.QueueTime != nil {
+		n += 2 + sovRpc(uint64(*m.QueueTime))
+	}
+	if m.Priority != nil {
+		n += 2 + sovRpc(uint64(*m.Priority))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -744,6 +1444,54 @@ func (m *RPCResponse) Size() (n int) {
 		l = m.Traceinfo.Size()
 		n += 1 + l + sovRpc(uint64(l))
 	}
+	if m.StreamSeq != nil {
+		n += 1 + sovRpc(uint64(*m.StreamSeq))
+	}
+	if m.StreamMore != nil {
+		n += 2
+	}
+	if m.StreamCredit != nil {
+		n += 1 + sovRpc(uint64(*m.StreamCredit))
+	}
+	if m.Compression != nil {
+		l = len(*m.Compression)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if len(m.Metadata) > 0 {
+		for _, e := range m.Metadata {
+			l = e.Size()
+			n += 1 + l + sovRpc(uint64(l))
+		}
+	}
+	if m.RetryAfter != nil {
+		n += 1 + sovRpc(uint64(*m.RetryAfter))
+	}
+	if m.XXX_unrecognized != nil {
+		n += len(m.XXX_unrecognized)
+	}
+	return n
+}
+
+func (m *PubSubMessage) Size() (n int) {
+	if m == nil {
+		return 0
+	}
+	var l int
+	_ = l
+	if m.Topic != nil {
+		l = len(*m.Topic)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.Sequence != nil {
+		n += 1 + sovRpc(uint64(*m.Sequence))
+	}
+	if m.Data != nil {
+		l = len(m.Data)
+		n += 1 + l + sovRpc(uint64(l))
+	}
+	if m.PublishedTime != nil {
+		n += 1 + sovRpc(uint64(*m.PublishedTime))
+	}
 	if m.XXX_unrecognized != nil {
 		n += len(m.XXX_unrecognized)
 	}
@@ -994,6 +1742,26 @@ func (m *TraceInfo) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueueTime", wireType)
+			}
+			var v int64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.QueueTime = &v
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -1025,7 +1793,7 @@ func (m *TraceInfo) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *RPCRequest) Unmarshal(dAtA []byte) error {
+func (m *KeyValue) Unmarshal(dAtA []byte) error {
 	var hasFields [1]uint64
 	l := len(dAtA)
 	iNdEx := 0
@@ -1049,17 +1817,780 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: RPCRequest: wiretype end group for non-group")
+			return fmt.Errorf("proto: KeyValue: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: RPCRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: KeyValue: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field RpcId", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Key", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.Key = &s
+			iNdEx = postIndex
+			hasFields[0] |= uint64(0x00000001)
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Value", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.Value = &s
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+	if hasFields[0]&uint64(0x00000001) == 0 {
+		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("key")
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RPCRequest) Unmarshal(dAtA []byte) error {
+	var hasFields [1]uint64
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RPCRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RPCRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RpcId", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.RpcId = &s
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Srvc", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.Srvc = &s
+			iNdEx = postIndex
+			hasFields[0] |= uint64(0x00000001)
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Procedure", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.Procedure = &s
+			iNdEx = postIndex
+			hasFields[0] |= uint64(0x00000002)
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
+			iNdEx = postIndex
+			hasFields[0] |= uint64(0x00000004)
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Deadline", wireType)
+			}
+			var v int64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Deadline = &v
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field CallerId", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.CallerId = &s
+			iNdEx = postIndex
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field WantTrace", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			b := bool(v != 0)
+			m.WantTrace = &b
+		case 8:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field OneWay", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			b := bool(v != 0)
+			m.OneWay = &b
+		case 9:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamId", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.StreamId = &s
+			iNdEx = postIndex
+		case 10:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamCredit", wireType)
+			}
+			var v uint32
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.StreamCredit = &v
+		case 11:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamMessage", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			b := bool(v != 0)
+			m.StreamMessage = &b
+		case 12:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamHalfClose", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			b := bool(v != 0)
+			m.StreamHalfClose = &b
+		case 13:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamCancel", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			b := bool(v != 0)
+			m.StreamCancel = &b
+		case 14:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Compression", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.Compression = &s
+			iNdEx = postIndex
+		case 15:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AcceptCompression", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.AcceptCompression = &s
+			iNdEx = postIndex
+		case 16:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Metadata = append(m.Metadata, &KeyValue{})
+			if err := m.Metadata[len(m.Metadata)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 17:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TimeoutBudget", wireType)
+			}
+			var v int64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.TimeoutBudget = &v
+		case 18:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueueTime", wireType)
+			}
+			var v int64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.QueueTime = &v
+		case 19:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Priority", wireType)
+			}
+			var v uint32
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= uint32(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.Priority = &v
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRpc(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.XXX_unrecognized = append(m.XXX_unrecognized, dAtA[iNdEx:iNdEx+skippy]...)
+			iNdEx += skippy
+		}
+	}
+	if hasFields[0]&uint64(0x00000001) == 0 {
+		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("srvc")
+	}
+	if hasFields[0]&uint64(0x00000002) == 0 {
+		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("procedure")
+	}
+	if hasFields[0]&uint64(0x00000004) == 0 {
+		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("data")
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *RPCResponse) Unmarshal(dAtA []byte) error {
+	var hasFields [1]uint64
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowRpc
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: RPCResponse: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: RPCResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field RpcId", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			s := string(dAtA[iNdEx:postIndex])
+			m.RpcId = &s
+			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResponseData", wireType)
+			}
+			var byteLen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				byteLen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if byteLen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + byteLen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ResponseData = append(m.ResponseData[:0], dAtA[iNdEx:postIndex]...)
+			if m.ResponseData == nil {
+				m.ResponseData = []byte{}
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ResponseStatus", wireType)
 			}
-			var stringLen uint64
+			var v RPCResponse_Status
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1069,28 +2600,16 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				v |= RPCResponse_Status(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
-				return ErrInvalidLengthRpc
-			}
-			postIndex := iNdEx + intStringLen
-			if postIndex < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			s := string(dAtA[iNdEx:postIndex])
-			m.RpcId = &s
-			iNdEx = postIndex
-		case 2:
+			m.ResponseStatus = &v
+			hasFields[0] |= uint64(0x00000001)
+		case 4:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Srvc", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field ErrorMessage", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -1119,14 +2638,13 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 				return io.ErrUnexpectedEOF
 			}
 			s := string(dAtA[iNdEx:postIndex])
-			m.Srvc = &s
+			m.ErrorMessage = &s
 			iNdEx = postIndex
-			hasFields[0] |= uint64(0x00000001)
-		case 3:
+		case 5:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Procedure", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Traceinfo", wireType)
 			}
-			var stringLen uint64
+			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1136,31 +2654,33 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				msglen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if msglen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + msglen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			s := string(dAtA[iNdEx:postIndex])
-			m.Procedure = &s
+			if m.Traceinfo == nil {
+				m.Traceinfo = &TraceInfo{}
+			}
+			if err := m.Traceinfo.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
 			iNdEx = postIndex
-			hasFields[0] |= uint64(0x00000002)
-		case 4:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamSeq", wireType)
 			}
-			var byteLen int
+			var v uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1170,32 +2690,38 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				byteLen |= int(b&0x7F) << shift
+				v |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if byteLen < 0 {
-				return ErrInvalidLengthRpc
-			}
-			postIndex := iNdEx + byteLen
-			if postIndex < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
+			m.StreamSeq = &v
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamMore", wireType)
 			}
-			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
-			if m.Data == nil {
-				m.Data = []byte{}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
 			}
-			iNdEx = postIndex
-			hasFields[0] |= uint64(0x00000004)
-		case 5:
+			b := bool(v != 0)
+			m.StreamMore = &b
+		case 8:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Deadline", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field StreamCredit", wireType)
 			}
-			var v int64
+			var v uint32
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1205,15 +2731,15 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				v |= int64(b&0x7F) << shift
+				v |= uint32(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			m.Deadline = &v
-		case 6:
+			m.StreamCredit = &v
+		case 9:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field CallerId", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Compression", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -1242,13 +2768,47 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 				return io.ErrUnexpectedEOF
 			}
 			s := string(dAtA[iNdEx:postIndex])
-			m.CallerId = &s
+			m.Compression = &s
 			iNdEx = postIndex
-		case 7:
+		case 10:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowRpc
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthRpc
+			}
+			postIndex := iNdEx + msglen
+			if postIndex < 0 {
+				return ErrInvalidLengthRpc
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Metadata = append(m.Metadata, &KeyValue{})
+			if err := m.Metadata[len(m.Metadata)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 11:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field WantTrace", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field RetryAfter", wireType)
 			}
-			var v int
+			var v int64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1258,13 +2818,12 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				v |= int(b&0x7F) << shift
+				v |= int64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			b := bool(v != 0)
-			m.WantTrace = &b
+			m.RetryAfter = &v
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -1285,13 +2844,7 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 		}
 	}
 	if hasFields[0]&uint64(0x00000001) == 0 {
-		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("srvc")
-	}
-	if hasFields[0]&uint64(0x00000002) == 0 {
-		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("procedure")
-	}
-	if hasFields[0]&uint64(0x00000004) == 0 {
-		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("data")
+		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("response_status")
 	}
 
 	if iNdEx > l {
@@ -1299,7 +2852,7 @@ func (m *RPCRequest) Unmarshal(dAtA []byte) error {
 	}
 	return nil
 }
-func (m *RPCResponse) Unmarshal(dAtA []byte) error {
+func (m *PubSubMessage) Unmarshal(dAtA []byte) error {
 	var hasFields [1]uint64
 	l := len(dAtA)
 	iNdEx := 0
@@ -1323,15 +2876,15 @@ func (m *RPCResponse) Unmarshal(dAtA []byte) error {
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return fmt.Errorf("proto: RPCResponse: wiretype end group for non-group")
+			return fmt.Errorf("proto: PubSubMessage: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return fmt.Errorf("proto: RPCResponse: illegal tag %d (wire type %d)", fieldNum, wire)
+			return fmt.Errorf("proto: PubSubMessage: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field RpcId", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Topic", wireType)
 			}
 			var stringLen uint64
 			for shift := uint(0); ; shift += 7 {
@@ -1360,47 +2913,14 @@ func (m *RPCResponse) Unmarshal(dAtA []byte) error {
 				return io.ErrUnexpectedEOF
 			}
 			s := string(dAtA[iNdEx:postIndex])
-			m.RpcId = &s
+			m.Topic = &s
 			iNdEx = postIndex
+			hasFields[0] |= uint64(0x00000001)
 		case 2:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ResponseData", wireType)
-			}
-			var byteLen int
-			for shift := uint(0); ; shift += 7 {
-				if shift >= 64 {
-					return ErrIntOverflowRpc
-				}
-				if iNdEx >= l {
-					return io.ErrUnexpectedEOF
-				}
-				b := dAtA[iNdEx]
-				iNdEx++
-				byteLen |= int(b&0x7F) << shift
-				if b < 0x80 {
-					break
-				}
-			}
-			if byteLen < 0 {
-				return ErrInvalidLengthRpc
-			}
-			postIndex := iNdEx + byteLen
-			if postIndex < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			m.ResponseData = append(m.ResponseData[:0], dAtA[iNdEx:postIndex]...)
-			if m.ResponseData == nil {
-				m.ResponseData = []byte{}
-			}
-			iNdEx = postIndex
-		case 3:
 			if wireType != 0 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ResponseStatus", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Sequence", wireType)
 			}
-			var v RPCResponse_Status
+			var v uint64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1410,18 +2930,18 @@ func (m *RPCResponse) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				v |= RPCResponse_Status(b&0x7F) << shift
+				v |= uint64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			m.ResponseStatus = &v
-			hasFields[0] |= uint64(0x00000001)
-		case 4:
+			m.Sequence = &v
+			hasFields[0] |= uint64(0x00000002)
+		case 3:
 			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field ErrorMessage", wireType)
+				return fmt.Errorf("proto: wrong wireType = %d for field Data", wireType)
 			}
-			var stringLen uint64
+			var byteLen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1431,30 +2951,31 @@ func (m *RPCResponse) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				stringLen |= uint64(b&0x7F) << shift
+				byteLen |= int(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			intStringLen := int(stringLen)
-			if intStringLen < 0 {
+			if byteLen < 0 {
 				return ErrInvalidLengthRpc
 			}
-			postIndex := iNdEx + intStringLen
+			postIndex := iNdEx + byteLen
 			if postIndex < 0 {
 				return ErrInvalidLengthRpc
 			}
 			if postIndex > l {
 				return io.ErrUnexpectedEOF
 			}
-			s := string(dAtA[iNdEx:postIndex])
-			m.ErrorMessage = &s
+			m.Data = append(m.Data[:0], dAtA[iNdEx:postIndex]...)
+			if m.Data == nil {
+				m.Data = []byte{}
+			}
 			iNdEx = postIndex
-		case 5:
-			if wireType != 2 {
-				return fmt.Errorf("proto: wrong wireType = %d for field Traceinfo", wireType)
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field PublishedTime", wireType)
 			}
-			var msglen int
+			var v int64
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
 					return ErrIntOverflowRpc
@@ -1464,28 +2985,12 @@ func (m *RPCResponse) Unmarshal(dAtA []byte) error {
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
-				msglen |= int(b&0x7F) << shift
+				v |= int64(b&0x7F) << shift
 				if b < 0x80 {
 					break
 				}
 			}
-			if msglen < 0 {
-				return ErrInvalidLengthRpc
-			}
-			postIndex := iNdEx + msglen
-			if postIndex < 0 {
-				return ErrInvalidLengthRpc
-			}
-			if postIndex > l {
-				return io.ErrUnexpectedEOF
-			}
-			if m.Traceinfo == nil {
-				m.Traceinfo = &TraceInfo{}
-			}
-			if err := m.Traceinfo.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return err
-			}
-			iNdEx = postIndex
+			m.PublishedTime = &v
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRpc(dAtA[iNdEx:])
@@ -1506,7 +3011,10 @@ func (m *RPCResponse) Unmarshal(dAtA []byte) error {
 		}
 	}
 	if hasFields[0]&uint64(0x00000001) == 0 {
-		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("response_status")
+		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("topic")
+	}
+	if hasFields[0]&uint64(0x00000002) == 0 {
+		return github_com_gogo_protobuf_proto.NewRequiredNotSetError("sequence")
 	}
 
 	if iNdEx > l {
@@ -1517,6 +3025,7 @@ func (m *RPCResponse) Unmarshal(dAtA []byte) error {
 func skipRpc(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
+	depth := 0
 	for iNdEx < l {
 		var wire uint64
 		for shift := uint(0); ; shift += 7 {
@@ -1548,10 +3057,8 @@ func skipRpc(dAtA []byte) (n int, err error) {
 					break
 				}
 			}
-			return iNdEx, nil
 		case 1:
 			iNdEx += 8
-			return iNdEx, nil
 		case 2:
 			var length int
 			for shift := uint(0); ; shift += 7 {
@@ -1572,55 +3079,30 @@ func skipRpc(dAtA []byte) (n int, err error) {
 				return 0, ErrInvalidLengthRpc
 			}
 			iNdEx += length
-			if iNdEx < 0 {
-				return 0, ErrInvalidLengthRpc
-			}
-			return iNdEx, nil
 		case 3:
-			for {
-				var innerWire uint64
-				var start int = iNdEx
-				for shift := uint(0); ; shift += 7 {
-					if shift >= 64 {
-						return 0, ErrIntOverflowRpc
-					}
-					if iNdEx >= l {
-						return 0, io.ErrUnexpectedEOF
-					}
-					b := dAtA[iNdEx]
-					iNdEx++
-					innerWire |= (uint64(b) & 0x7F) << shift
-					if b < 0x80 {
-						break
-					}
-				}
-				innerWireType := int(innerWire & 0x7)
-				if innerWireType == 4 {
-					break
-				}
-				next, err := skipRpc(dAtA[start:])
-				if err != nil {
-					return 0, err
-				}
-				iNdEx = start + next
-				if iNdEx < 0 {
-					return 0, ErrInvalidLengthRpc
-				}
-			}
-			return iNdEx, nil
+			depth++
 		case 4:
-			return iNdEx, nil
+			if depth == 0 {
+				return 0, ErrUnexpectedEndOfGroupRpc
+			}
+			depth--
 		case 5:
 			iNdEx += 4
-			return iNdEx, nil
 		default:
 			return 0, fmt.Errorf("proto: illegal wireType %d", wireType)
 		}
+		if iNdEx < 0 {
+			return 0, ErrInvalidLengthRpc
+		}
+		if depth == 0 {
+			return iNdEx, nil
+		}
 	}
-	panic("unreachable")
+	return 0, io.ErrUnexpectedEOF
 }
 
 var (
-	ErrInvalidLengthRpc = fmt.Errorf("proto: negative length found during unmarshaling")
-	ErrIntOverflowRpc   = fmt.Errorf("proto: integer overflow")
+	ErrInvalidLengthRpc        = fmt.Errorf("proto: negative length found during unmarshaling")
+	ErrIntOverflowRpc          = fmt.Errorf("proto: integer overflow")
+	ErrUnexpectedEndOfGroupRpc = fmt.Errorf("proto: unexpected end of group")
 )
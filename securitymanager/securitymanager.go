@@ -2,6 +2,9 @@ package securitymanager
 
 import (
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pebbe/zmq4"
 )
@@ -12,8 +15,17 @@ const DONOTWRITE = "___donotwrite_key_to_file"
 // DONOTREAD can be used as file name if you don't want the key read from disk.
 const DONOTREAD = "___donotread_key_from_file"
 
+// Prefix of the ZAP domains; every manager has a domain of its own, so that servers with
+// different security configurations can coexist in one process.
 const serverDomain = "clusterrpc.srv"
 
+// Number of managers created so far, for unique domains
+var managers uint64
+
+// The ZAP handler is shared by all managers in the process; it runs while any manager uses it.
+var auth_lock sync.Mutex
+var auth_users int
+
 // This module manages keys for a clusterrpc server. It is built after the API calls
 // as shown in the Iron House example of ZeroMQs CURVE security documentation.
 
@@ -33,11 +45,17 @@ type ServerSecurityManager struct {
 	// Only set one of both!
 	allowedClientAddresses []string
 	deniedClientAddresses  []string
+
+	// ZAP domain of this manager's sockets
+	domain string
+	// Whether this manager has started using the ZAP handler
+	authStarted bool
 }
 
 // NewServerSecurityManager sets up a key manager and generates a new key pair.
 func NewServerSecurityManager() *ServerSecurityManager {
 	mgr := &ServerSecurityManager{}
+	mgr.domain = newDomain()
 	var err error
 
 	mgr.keyWriteLoader = new(keyWriteLoader)
@@ -70,25 +88,23 @@ func (mgr *ServerSecurityManager) ApplyToServerSocket(sock *zmq4.Socket) error {
 	} else if err != nil {
 		return err
 	}
-	// start in any case (returns error if already running, ignore that)
-	zmq4.AuthStart()
+	mgr.startAuth()
+	domain := mgr.zapDomain()
 
 	if mgr.allowedClientAddresses != nil {
-		// We can use a static string because this is the only server in the
-		// context.
-		zmq4.AuthAllow(serverDomain, mgr.allowedClientAddresses...)
+		zmq4.AuthAllow(domain, mgr.allowedClientAddresses...)
 	} else if mgr.deniedClientAddresses != nil {
-		zmq4.AuthDeny(serverDomain, mgr.deniedClientAddresses...)
+		zmq4.AuthDeny(domain, mgr.deniedClientAddresses...)
 	}
 
 	if mgr.private != "" {
 		if mgr.allowedClientKeys != nil {
-			zmq4.AuthCurveAdd(serverDomain, mgr.allowedClientKeys...)
+			zmq4.AuthCurveAdd(domain, mgr.allowedClientKeys...)
 		} else {
 			// Make it open
-			zmq4.AuthCurveAdd(serverDomain, zmq4.CURVE_ALLOW_ANY)
+			zmq4.AuthCurveAdd(domain, zmq4.CURVE_ALLOW_ANY)
 		}
-		err = sock.ServerAuthCurve(serverDomain, mgr.private)
+		err = sock.ServerAuthCurve(domain, mgr.private)
 		if err != nil {
 			return err
 		}
@@ -97,9 +113,65 @@ func (mgr *ServerSecurityManager) ApplyToServerSocket(sock *zmq4.Socket) error {
 	return nil
 }
 
-// StopManager tears down all resources associated with authentication
+// Returns a ZAP domain that hasn't been used before.
+func newDomain() string {
+	return fmt.Sprintf("%s.%d", serverDomain, atomic.AddUint64(&managers, 1))
+}
+
+// Returns the ZAP domain of this manager. Managers not created by NewServerSecurityManager()
+// share a common domain.
+func (mgr *ServerSecurityManager) zapDomain() string {
+	if mgr.domain == "" {
+		return serverDomain
+	}
+	return mgr.domain
+}
+
+// Start the ZAP handler, unless it is already running for another manager.
+func (mgr *ServerSecurityManager) startAuth() {
+	auth_lock.Lock()
+	defer auth_lock.Unlock()
+
+	if mgr.authStarted {
+		return
+	}
+	if auth_users == 0 {
+		zmq4.AuthSetMetadataHandler(curveUserId)
+		// returns an error if already running, ignore that
+		zmq4.AuthStart()
+	}
+	auth_users++
+	mgr.authStarted = true
+}
+
+// ZAP metadata handler: Sets the User-Id of connections authenticated with CURVE to the
+// client's Z85-encoded public key, so that servers can tell callers apart.
+func curveUserId(version, request_id, domain, address, identity, mechanism string, credentials ...string) map[string]string {
+	if mechanism == "CURVE" && len(credentials) > 0 {
+		return map[string]string{"User-Id": zmq4.Z85encode(credentials[0])}
+	}
+	return map[string]string{}
+}
+
+// StopManager tears down all resources associated with authentication. The ZAP handler
+// is stopped once no other manager uses it anymore.
 func (mgr *ServerSecurityManager) StopManager() {
-	zmq4.AuthStop()
+	auth_lock.Lock()
+	defer auth_lock.Unlock()
+
+	if !mgr.authStarted {
+		return
+	}
+	mgr.authStarted = false
+
+	zmq4.AuthCurveRemoveAll(mgr.zapDomain())
+	// zmq4 can't remove the addresses passed to AuthAllow() and AuthDeny(); continuing in a
+	// new domain makes sure that they don't apply anymore if the manager is used again.
+	mgr.domain = newDomain()
+
+	if auth_users--; auth_users == 0 {
+		zmq4.AuthStop()
+	}
 }
 
 // Disable CURVE authentication, only apply IP protection.
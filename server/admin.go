@@ -0,0 +1,209 @@
+package server
+
+/*
+* This file implements an optional HTTP server for operators. It shows the state of
+* a running server and allows changing lameduck/loadshed mode and the log level
+* without redeploying.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var loglevel_names []string = []string{"NONE", "ERRORS", "WARNINGS", "INFO", "DEBUG"}
+
+/*
+Returns an http.Handler serving the admin pages of srv:
+
+	GET  /healthz             200 if the server is healthy, 503 in lameduck mode
+	GET  /statusz             Endpoints, workers, queue and counters
+	GET  /rpcz                Recently sampled RPCs with traces (see SetSampleRate())
+	POST /lameduck?enable=b   Enable/disable lameduck mode
+	POST /loadshed?enable=b   Enable/disable loadshed mode
+	POST /loglevel?level=l    Set the log level (name like WARNINGS, or number)
+
+The handler can be mounted on an existing HTTP server; otherwise use StartAdminServer().
+*/
+func NewAdminHandler(srv *Server) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", srv.adminHealthz)
+	mux.HandleFunc("/statusz", srv.adminStatusz)
+	mux.HandleFunc("/rpcz", srv.adminRpcz)
+	mux.HandleFunc("/lameduck", adminToggle(srv.SetLameduck))
+	mux.HandleFunc("/loadshed", adminToggle(srv.SetLoadshed))
+	mux.HandleFunc("/loglevel", adminLoglevel)
+
+	return mux
+}
+
+/*
+Start an HTTP admin server on laddr (e.g. "localhost:8080") in the background. It is shut
+down by Close(). The admin server is not protected by the server's security manager, so
+it should only be reachable by operators.
+*/
+func (srv *Server) StartAdminServer(laddr string) error {
+	if srv.admin != nil {
+		return errors.New("Admin server already running")
+	}
+
+	listener, err := net.Listen("tcp", laddr)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not listen for admin server:", err.Error())
+		return err
+	}
+
+	srv.admin = &http.Server{Handler: NewAdminHandler(srv)}
+
+	go func() {
+		err := srv.admin.Serve(listener)
+
+		if err != nil && err != http.ErrServerClosed {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Admin server stopped:", err.Error())
+		}
+	}()
+
+	log.CRPC_log(log.LOGLEVEL_INFO, "Admin server listening on", listener.Addr().String())
+	return nil
+}
+
+func (srv *Server) adminHealthz(w http.ResponseWriter, r *http.Request) {
+	if srv.isLameduck() {
+		http.Error(w, "lameduck", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (srv *Server) adminStatusz(w http.ResponseWriter, r *http.Request) {
+	stats := srv.GetStats()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	fmt.Fprintf(w, "Machine: %s\n", srv.machine_name)
+	fmt.Fprintf(w, "Bound to: %s\n", strings.Join(srv.BindURLs(), ", "))
+	fmt.Fprintf(w, "State: %s\n", srv.State())
+	fmt.Fprintf(w, "Lameduck: %t\nLoadshed: %t\n", srv.isLameduck(), srv.isLoadshed())
+	fmt.Fprintf(w, "Log level: %s\n\n", loglevelName(log.GetLoglevel()))
+
+	fmt.Fprintf(w, "Workers: %d (%d busy)\n", stats.Workers, stats.BusyWorkers)
+	fmt.Fprintf(w, "Queue length: %d (capacity %d)\n", stats.QueueLength, stats.Workers*OUTSTANDING_REQUESTS_PER_THREAD)
+	fmt.Fprintf(w, "Received: %d\nProcessed: %d\nLoadshed: %d\nOverloaded: %d\nExpired: %d\nQuota exceeded: %d\nPanics: %d\nTimed out: %d\n",
+		stats.Received, stats.Processed, stats.Loadshed, stats.Overloaded, stats.Expired, stats.QuotaExceeded, stats.Panics, stats.TimedOut)
+
+	if stats.Queued > 0 {
+		fmt.Fprintf(w, "Queued: %d (average wait %v)\n", stats.Queued, stats.QueueWait/time.Duration(stats.Queued))
+	}
+	if target := srv.overloadTarget(); target > 0 {
+		fmt.Fprintf(w, "Overload control: shedding=%t, min. queue delay %v (target %v), shed %d\n",
+			stats.OverloadControl, stats.MinQueueDelay, target, stats.Shed)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "Endpoints:")
+	for _, endpoint := range srv.endpointNames() {
+		fmt.Fprintf(w, "  %s\n", endpoint)
+	}
+}
+
+func (srv *Server) adminRpcz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	rpcs := srv.GetSampledRPCs()
+
+	if len(rpcs) == 0 {
+		fmt.Fprintln(w, "No sampled RPCs. Use SetSampleRate() to enable sampling.")
+		return
+	}
+
+	for _, rpc := range rpcs {
+		fmt.Fprintf(w, "%s %s %s/%s %s [%v]\n", rpc.Time.Format(TRACE_INFO_TIME_FORMAT), rpc.Endpoint,
+			rpc.CallerId, rpc.RpcId, rpc.Status.String(), rpc.Duration)
+		fmt.Fprintln(w, FormatTraceInfo(rpc.Trace, 2))
+	}
+}
+
+// Returns a handler that calls set with the value of the "enable" parameter.
+func adminToggle(set func(bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST required", http.StatusMethodNotAllowed)
+			return
+		}
+
+		enable, err := strconv.ParseBool(r.FormValue("enable"))
+
+		if err != nil {
+			http.Error(w, "Bad value for enable: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.CRPC_log(log.LOGLEVEL_INFO, "Admin request from", r.RemoteAddr, ":", r.URL.Path, "=", enable)
+		set(enable)
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func adminLoglevel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST required", http.StatusMethodNotAllowed)
+		return
+	}
+
+	level, err := parseLoglevel(r.FormValue("level"))
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.CRPC_log(log.LOGLEVEL_INFO, "Admin request from", r.RemoteAddr, ": log level =", loglevel_names[level])
+	log.SetLoglevel(level)
+	fmt.Fprintln(w, "ok")
+}
+
+// The application may have set a level outside of the known ones.
+func loglevelName(level int) string {
+	if level < 0 || level >= len(loglevel_names) {
+		return strconv.Itoa(level)
+	}
+	return loglevel_names[level]
+}
+
+// Accepts either a number or a name from loglevel_names (case-insensitive).
+func parseLoglevel(s string) (int, error) {
+	for i, name := range loglevel_names {
+		if strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+
+	level, err := strconv.Atoi(s)
+
+	if err != nil || level < log.LOGLEVEL_NONE || level > log.LOGLEVEL_DEBUG {
+		return 0, fmt.Errorf("Bad log level: %q", s)
+	}
+	return level, nil
+}
+
+// Returns the sorted names (Service.Endpoint) of all registered endpoints.
+func (srv *Server) endpointNames() []string {
+	names := []string{}
+
+	for svcname, svc := range srv.services() {
+		for endpoint := range svc.endpoints {
+			names = append(names, svcname+"."+endpoint)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dermesser/clusterrpc/log"
+)
+
+func adminRequest(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestAdminLameduck(t *testing.T) {
+	srv := newRegistryTestServer()
+	h := NewAdminHandler(srv)
+
+	if w := adminRequest(h, http.MethodGet, "/healthz"); w.Code != http.StatusOK {
+		t.Fatal("unhealthy:", w.Code)
+	}
+	if w := adminRequest(h, http.MethodGet, "/lameduck?enable=true"); w.Code != http.StatusMethodNotAllowed {
+		t.Fatal("GET changed lameduck mode:", w.Code)
+	}
+	if w := adminRequest(h, http.MethodPost, "/lameduck?enable=maybe"); w.Code != http.StatusBadRequest {
+		t.Fatal("bad value accepted:", w.Code)
+	}
+	if w := adminRequest(h, http.MethodPost, "/lameduck?enable=true"); w.Code != http.StatusOK {
+		t.Fatal("could not enable lameduck mode:", w.Code)
+	}
+	if w := adminRequest(h, http.MethodGet, "/healthz"); w.Code != http.StatusServiceUnavailable {
+		t.Fatal("healthy in lameduck mode:", w.Code)
+	}
+	if w := adminRequest(h, http.MethodPost, "/loadshed?enable=1"); w.Code != http.StatusOK || !srv.isLoadshed() {
+		t.Fatal("could not enable loadshed mode:", w.Code)
+	}
+}
+
+func TestAdminStatusz(t *testing.T) {
+	srv := newRegistryTestServer()
+	srv.RegisterHandler("Test", "Echo", nopHandler)
+
+	w := adminRequest(NewAdminHandler(srv), http.MethodGet, "/statusz")
+	body := w.Body.String()
+
+	if w.Code != http.StatusOK || !strings.Contains(body, "  Test.Echo\n") || !strings.Contains(body, "State: CREATED") {
+		t.Error("unexpected /statusz:", w.Code, body)
+	}
+}
+
+func TestAdminLoglevel(t *testing.T) {
+	defer log.SetLoglevel(log.GetLoglevel())
+	h := NewAdminHandler(newRegistryTestServer())
+
+	if w := adminRequest(h, http.MethodPost, "/loglevel?level=debug"); w.Code != http.StatusOK ||
+		log.GetLoglevel() != log.LOGLEVEL_DEBUG {
+		t.Fatal("could not set log level by name:", w.Code)
+	}
+	if w := adminRequest(h, http.MethodPost, "/loglevel?level=1"); w.Code != http.StatusOK ||
+		log.GetLoglevel() != log.LOGLEVEL_ERRORS {
+		t.Fatal("could not set log level by number:", w.Code)
+	}
+	if w := adminRequest(h, http.MethodPost, "/loglevel?level=99"); w.Code != http.StatusBadRequest {
+		t.Fatal("bad log level accepted:", w.Code)
+	}
+}
+
+func TestLoglevelName(t *testing.T) {
+	if loglevelName(log.LOGLEVEL_WARNINGS) != "WARNINGS" || loglevelName(-1) != "-1" || loglevelName(17) != "17" {
+		t.Error("unexpected names:", loglevelName(log.LOGLEVEL_WARNINGS), loglevelName(-1), loglevelName(17))
+	}
+}
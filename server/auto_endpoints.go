@@ -9,9 +9,9 @@ import ()
 
 // Returns a handler function that returns OK and an empty body
 // iff the server is not in lameduck/loadshed mode, otherwise a NOT_OK status.
-func makeHealthHandler(lameduck_state *bool) Handler {
+func makeHealthHandler(lameduck func() bool) Handler {
 	return func(ctx *Context) {
-		if !*lameduck_state {
+		if !lameduck() {
 			ctx.Success([]byte{})
 			return
 		} else {
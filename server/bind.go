@@ -0,0 +1,133 @@
+package server
+
+/*
+* Binding the frontend to several endpoints, and changing the bound endpoints at runtime.
+* The frontend router is owned by the load balancer once the server is serving, so Bind()
+* and Unbind() are executed by it then.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	smgr "github.com/dermesser/clusterrpc/securitymanager"
+	"strings"
+)
+
+// Returns the endpoint URL for listening on host:port with TCP. IPv6 addresses are
+// enclosed in brackets.
+func TCPEndpoint(host string, port uint) string {
+	if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		host = "[" + host + "]"
+	}
+	return fmt.Sprintf("tcp://%s:%d", host, port)
+}
+
+// Returns the endpoint URL for listening on a unix socket at path.
+func IPCEndpoint(path string) string {
+	return fmt.Sprintf("ipc://%s", path)
+}
+
+/*
+Create a server listening on all bindurls, which are ZeroMQ endpoints like
+"tcp://0.0.0.0:9000", "tcp://[::]:9000" or "ipc:///run/app.sock" (see TCPEndpoint() and
+IPCEndpoint()). The other arguments are like for NewServer().
+*/
+func NewMultiServer(bindurls []string, threads uint, security_manager *smgr.ServerSecurityManager, opts ...ServerOption) (*Server, error) {
+	if len(bindurls) == 0 {
+		return nil, errors.New("No endpoints to bind to")
+	}
+	return newServer(bindurls, threads, security_manager, makeServerOptions(opts))
+}
+
+// An endpoint the frontend is bound to: as given by the user, and as resolved by ZeroMQ.
+type boundEndpoint struct {
+	url, endpoint string
+}
+
+// Returns the endpoints the server is bound to.
+func (srv *Server) BindURLs() []string {
+	srv.bindurls_lock.Lock()
+	defer srv.bindurls_lock.Unlock()
+
+	urls := make([]string, len(srv.bindurls))
+	for i, b := range srv.bindurls {
+		urls[i] = b.url
+	}
+	return urls
+}
+
+/*
+Bind the frontend router to bindurl and remember the endpoint as resolved by ZeroMQ (e.g.
+tcp://0.0.0.0:9000 for tcp://*:9000); only the resolved endpoint can be unbound later.
+bindurls_lock must be held if the server is running.
+*/
+func (srv *Server) bindFrontend(bindurl string) error {
+	log.CRPC_log(log.LOGLEVEL_INFO, "Binding frontend to ", bindurl)
+
+	if err := srv.frontend_router.Bind(bindurl); err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when binding Router socket:", err.Error())
+		return err
+	}
+
+	endpoint, err := srv.frontend_router.GetLastEndpoint()
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Could not get endpoint bound to", bindurl, ":", err.Error())
+		endpoint = bindurl
+	}
+	srv.bindurls = append(srv.bindurls, boundEndpoint{url: bindurl, endpoint: endpoint})
+	return nil
+}
+
+/*
+Start listening on another endpoint. Together with Unbind(), this allows moving a server to
+another port without downtime: Bind to the new port, let clients move over, and unbind the
+old port.
+*/
+func (srv *Server) Bind(bindurl string) error {
+	return srv.onFrontend(func() error {
+		srv.bindurls_lock.Lock()
+		defer srv.bindurls_lock.Unlock()
+
+		for _, b := range srv.bindurls {
+			if b.url == bindurl {
+				return errors.New("Already bound to " + bindurl)
+			}
+		}
+		return srv.bindFrontend(bindurl)
+	})
+}
+
+/*
+Stop listening on an endpoint that was bound with the constructor or Bind(). Connections
+established through this endpoint are not closed. bindurl must be given exactly like when
+binding.
+*/
+func (srv *Server) Unbind(bindurl string) error {
+	return srv.onFrontend(func() error {
+		srv.bindurls_lock.Lock()
+		defer srv.bindurls_lock.Unlock()
+
+		for i, b := range srv.bindurls {
+			if b.url != bindurl {
+				continue
+			}
+
+			log.CRPC_log(log.LOGLEVEL_INFO, "Unbinding frontend from ", bindurl)
+
+			if err := srv.frontend_router.Unbind(b.endpoint); err != nil {
+				log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when unbinding Router socket:", err.Error())
+				return err
+			}
+			srv.bindurls = append(srv.bindurls[:i], srv.bindurls[i+1:]...)
+			return nil
+		}
+		return errors.New("Not bound to " + bindurl)
+	})
+}
+
+// Execute f, which uses the frontend router, like onBalancer(). Returns the error returned by f.
+func (srv *Server) onFrontend(f func() error) error {
+	return srv.onBalancer(func(*balancer) error { return f() })
+}
@@ -0,0 +1,31 @@
+package server
+
+import "testing"
+
+func TestTCPEndpoint(t *testing.T) {
+	cases := map[string]string{
+		"127.0.0.1": "tcp://127.0.0.1:9000",
+		"*":         "tcp://*:9000",
+		"::1":       "tcp://[::1]:9000",
+		"[::]":      "tcp://[::]:9000",
+		"localhost": "tcp://localhost:9000",
+	}
+
+	for host, url := range cases {
+		if e := TCPEndpoint(host, 9000); e != url {
+			t.Error("TCPEndpoint", host, "=", e, "instead of", url)
+		}
+	}
+}
+
+func TestIPCEndpoint(t *testing.T) {
+	if e := IPCEndpoint("/run/app.sock"); e != "ipc:///run/app.sock" {
+		t.Error("unexpected endpoint:", e)
+	}
+}
+
+func TestNewMultiServerWithoutEndpoints(t *testing.T) {
+	if _, err := NewMultiServer(nil, 1, nil); err == nil {
+		t.Error("server without endpoints created")
+	}
+}
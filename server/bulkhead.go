@@ -0,0 +1,201 @@
+package server
+
+/*
+* This file implements bulkheads: Limits on the number of workers that may execute an endpoint
+* or all endpoints of a service at the same time, so that a slow endpoint can't occupy all
+* workers. Requests beyond a limit wait in a separate queue of the bulkhead (or are refused),
+* and don't block requests to other endpoints in the main queue.
+ */
+
+import (
+	"github.com/dermesser/clusterrpc/proto"
+	"github.com/dermesser/clusterrpc/server/queue"
+	"time"
+)
+
+// Options for registering handlers (see RegisterHandler()).
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	max_concurrent, service_max_concurrent int
+	reject_excess                          bool
+	// See HandlerTimeout() and ServiceTimeout()
+	timeout, service_timeout time.Duration
+}
+
+// Limit the number of workers executing this endpoint at the same time.
+func MaxConcurrent(n int) HandlerOption {
+	return func(o *handlerOptions) {
+		o.max_concurrent = n
+	}
+}
+
+// Limit the number of workers executing endpoints of this endpoint's service at the same time.
+// Applies to all endpoints of the service, including ones registered without this option.
+func ServiceMaxConcurrent(n int) HandlerOption {
+	return func(o *handlerOptions) {
+		o.service_max_concurrent = n
+	}
+}
+
+/*
+Refuse requests beyond the concurrency limits set with MaxConcurrent() and ServiceMaxConcurrent()
+with STATUS_OVERLOADED_RETRY. By default, they wait in a queue of their own with room for
+OUTSTANDING_REQUESTS_PER_THREAD requests.
+*/
+func RejectExcess() HandlerOption {
+	return func(o *handlerOptions) {
+		o.reject_excess = true
+	}
+}
+
+// A concurrency limit as configured for an endpoint or a service.
+type concurrencyLimit struct {
+	max_concurrent int
+	reject_excess  bool
+}
+
+// State of a concurrency limit in the load balancer.
+type bulkhead struct {
+	limit   concurrencyLimit
+	running int
+	// *lbRequest held back because of the limit
+	waiting queue.Queue
+}
+
+// Returns the bulkheads a request is subject to.
+func (srv *Server) bulkheadsFor(lb *balancer, request *proto.RPCRequest) []*bulkhead {
+	svc, ok := srv.services()[request.GetSrvc()]
+
+	if !ok {
+		return nil
+	}
+
+	var bulkheads []*bulkhead
+
+	if svc.limit.max_concurrent > 0 {
+		bulkheads = append(bulkheads, lb.getBulkhead(request.GetSrvc(), svc.limit))
+	}
+	if ep, ok := svc.endpoints[request.GetProcedure()]; ok && ep.limit.max_concurrent > 0 {
+		bulkheads = append(bulkheads, lb.getBulkhead(request.GetSrvc()+"."+request.GetProcedure(), ep.limit))
+	}
+	return bulkheads
+}
+
+func (lb *balancer) getBulkhead(name string, limit concurrencyLimit) *bulkhead {
+	b, ok := lb.bulkheads[name]
+
+	if !ok {
+		b = &bulkhead{waiting: queue.NewQueue(int(OUTSTANDING_REQUESTS_PER_THREAD))}
+		lb.bulkheads[name] = b
+	}
+	b.limit = limit
+	return b
+}
+
+// Returns the first bulkhead that doesn't allow rq to run now, or nil.
+func (lb *balancer) blockedBy(rq *lbRequest) *bulkhead {
+	for _, b := range rq.bulkheads {
+		if b.running >= b.limit.max_concurrent {
+			return b
+		}
+	}
+	return nil
+}
+
+// Hold back a request in the queue of a bulkhead that doesn't allow it to run.
+func (srv *Server) holdBack(lb *balancer, rq *lbRequest, b *bulkhead) {
+	if b.limit.reject_excess || b.waiting.Len() >= int(OUTSTANDING_REQUESTS_PER_THREAD) {
+		srv.refuse(lb, rq)
+		return
+	}
+
+	if rq.enqueued.IsZero() {
+		lb.openStream(rq)
+		rq.enqueued = time.Now()
+	}
+	b.waiting.Push(rq)
+}
+
+// Count a request against its bulkheads while a worker executes it.
+func (lb *balancer) enterBulkheads(worker_id []byte, rq *lbRequest) {
+	if len(rq.bulkheads) == 0 {
+		return
+	}
+	for _, b := range rq.bulkheads {
+		b.running++
+	}
+	lb.worker_bulkheads[string(worker_id)] = rq.bulkheads
+}
+
+// A worker has finished its request. Returns the bulkheads that have room again.
+func (lb *balancer) leaveBulkheads(worker_id []byte) []*bulkhead {
+	bulkheads := lb.worker_bulkheads[string(worker_id)]
+	delete(lb.worker_bulkheads, string(worker_id))
+
+	for _, b := range bulkheads {
+		b.running--
+	}
+	return bulkheads
+}
+
+/*
+Returns the bulkheads that hold back requests and have room for more, those in released (the
+bulkheads of a request that has just finished) first. A held-back request may also be waiting
+for a free worker rather than for its bulkhead, e.g. if the worker that left the bulkhead was
+retired, so all bulkheads are considered.
+*/
+func (lb *balancer) runnableBulkheads(released []*bulkhead) []*bulkhead {
+	var runnable []*bulkhead
+
+	for _, b := range released {
+		if b.runnable() {
+			runnable = append(runnable, b)
+		}
+	}
+	for _, b := range lb.bulkheads {
+		if b.runnable() && !containsBulkhead(released, b) {
+			runnable = append(runnable, b)
+		}
+	}
+	return runnable
+}
+
+func (b *bulkhead) runnable() bool {
+	return b.waiting.Len() > 0 && b.running < b.limit.max_concurrent
+}
+
+func containsBulkhead(bulkheads []*bulkhead, b *bulkhead) bool {
+	for _, c := range bulkheads {
+		if c == b {
+			return true
+		}
+	}
+	return false
+}
+
+// Dispatch requests held back by bulkheads that have room, while there are free workers. Called
+// whenever a worker has become available.
+func (srv *Server) scheduleBulkheads(lb *balancer, released []*bulkhead) {
+	if lb.worker_queue.Len() == 0 {
+		return
+	}
+
+	for _, b := range lb.runnableBulkheads(released) {
+		for b.runnable() && lb.worker_queue.Len() > 0 {
+			rq := b.waiting.Pop().(*lbRequest)
+
+			if srv.dropExpired(lb, rq) {
+				continue
+			}
+
+			// Another limit may apply as well
+			if other := lb.blockedBy(rq); other != nil {
+				srv.holdBack(lb, rq, other)
+				continue
+			}
+
+			srv.dispatch(lb, lb.worker_queue.Pop().([]byte), rq)
+		}
+	}
+}
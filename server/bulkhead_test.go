@@ -0,0 +1,87 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dermesser/clusterrpc/proto"
+	"github.com/dermesser/clusterrpc/server/queue"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func newTestBalancer() *balancer {
+	return &balancer{worker_queue: queue.NewQueue(4), bulkheads: make(map[string]*bulkhead),
+		worker_bulkheads: make(map[string][]*bulkhead)}
+}
+
+func newTestRequest(lb *balancer, bulkheads ...string) *lbRequest {
+	rq := &lbRequest{request: &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Limited")}}
+
+	for _, name := range bulkheads {
+		rq.bulkheads = append(rq.bulkheads, lb.getBulkhead(name, concurrencyLimit{max_concurrent: 1}))
+	}
+	return rq
+}
+
+func TestBulkheadHoldsBackExcessRequests(t *testing.T) {
+	srv := &Server{}
+	lb := newTestBalancer()
+
+	first := newTestRequest(lb, "Test", "Test.Limited")
+
+	if b := lb.blockedBy(first); b != nil {
+		t.Fatal("first request blocked")
+	}
+	lb.enterBulkheads([]byte("w1"), first)
+
+	second := newTestRequest(lb, "Test", "Test.Limited")
+	b := lb.blockedBy(second)
+
+	if b != lb.bulkheads["Test"] {
+		t.Fatal("second request not blocked by the service limit")
+	}
+	srv.holdBack(lb, second, b)
+
+	if b.waiting.Len() != 1 || second.enqueued.IsZero() {
+		t.Fatal("second request not held back")
+	}
+
+	released := lb.leaveBulkheads([]byte("w1"))
+
+	if len(released) != 2 || lb.bulkheads["Test"].running != 0 || lb.bulkheads["Test.Limited"].running != 0 {
+		t.Fatal("unexpected bulkheads after leaving:", released)
+	}
+	if lb.blockedBy(second) != nil {
+		t.Fatal("second request still blocked")
+	}
+}
+
+// The worker leaving the bulkhead is retired, so that the held-back request has to wait for
+// another worker; that one must find it although it didn't run a request of the bulkhead.
+func TestBulkheadRequestsNotStrandedByRetiredWorker(t *testing.T) {
+	srv := &Server{}
+	lb := newTestBalancer()
+
+	limited := newTestRequest(lb, "Test.Limited")
+	lb.enterBulkheads([]byte("w1"), limited)
+	lb.enterBulkheads([]byte("w2"), newTestRequest(lb))
+
+	held := newTestRequest(lb, "Test.Limited")
+	srv.holdBack(lb, held, lb.blockedBy(held))
+
+	// w1 finishes and is retired instead of being queued again.
+	lb.leaveBulkheads([]byte("w1"))
+
+	// w2 finishes a request without concurrency limit.
+	released := lb.leaveBulkheads([]byte("w2"))
+
+	if len(released) != 0 {
+		t.Fatal("unexpected bulkheads released:", released)
+	}
+
+	runnable := lb.runnableBulkheads(released)
+
+	if len(runnable) != 1 || runnable[0] != lb.bulkheads["Test.Limited"] {
+		t.Fatal("held-back request stranded:", runnable)
+	}
+}
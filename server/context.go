@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/dermesser/clusterrpc/proto"
 	"log"
+	"sync"
 	"time"
 
 	pb "github.com/gogo/protobuf/proto"
@@ -19,9 +20,25 @@ type Context struct {
 	this_call *proto.TraceInfo
 
 	orig_rq *proto.RPCRequest
-	logger  *log.Logger
+	// Set by SetResponseMetadata()
+	response_metadata []*proto.KeyValue
+	logger            *log.Logger
 	// 0 = None, 1 = logged request, 2 = logged response
 	log_state int
+
+	// Closed when the request is canceled
+	done        chan struct{}
+	cancel_once sync.Once
+
+	// For deferred responses (see Detach()): the server and where to send the response.
+	// response_lock protects the other fields: whether the response has been sent, or the
+	// request has timed out (see HandlerTimeout()), and the timer enforcing the timeout of a
+	// detached Context.
+	srv                            *Server
+	reply_to                       *workerRequest
+	response_lock                  sync.Mutex
+	detached, responded, timed_out bool
+	watchdog                       *time.Timer
 }
 
 func (srv *Server) newContext(request *proto.RPCRequest, logger *log.Logger) *Context {
@@ -30,21 +47,52 @@ func (srv *Server) newContext(request *proto.RPCRequest, logger *log.Logger) *Co
 	c.failed = false
 	c.orig_rq = request
 	c.logger = logger
+	c.done = make(chan struct{})
+	c.srv = srv
 
-	if request.GetDeadline() > 0 {
-		c.deadline = time.Unix(0, 1000*request.GetDeadline())
-	}
+	c.deadline = requestDeadline(request, time.Now())
 
 	if request.GetWantTrace() {
-		c.this_call = new(proto.TraceInfo)
-		c.this_call.EndpointName = pb.String(request.GetSrvc() + "." + request.GetProcedure())
-		c.this_call.MachineName = pb.String(srv.machine_name)
-		c.this_call.ReceivedTime = pb.Int64(time.Now().UnixNano() / 1000)
+		c.startTrace(srv.machine_name)
 	}
 
 	return c
 }
 
+/*
+Returns the local time after which the caller doesn't wait for a response anymore, or the
+zero time if it didn't send a timeout. received is the time the request arrived at.
+*/
+func requestDeadline(request *proto.RPCRequest, received time.Time) time.Time {
+	if request.TimeoutBudget != nil {
+		return received.Add(time.Duration(request.GetTimeoutBudget()) * time.Microsecond)
+	} else if request.GetDeadline() > 0 {
+		// Sent by older clients
+		return time.Unix(0, 1000*request.GetDeadline())
+	}
+	return time.Time{}
+}
+
+// Whether deadline (as returned by requestDeadline()) has passed at now.
+func deadlinePassed(deadline, now time.Time) bool {
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+// Start collecting tracing info for this call, even if the caller didn't ask for it.
+func (c *Context) startTrace(machine_name string) {
+	if c.this_call != nil {
+		return
+	}
+	c.this_call = new(proto.TraceInfo)
+	c.this_call.EndpointName = pb.String(c.orig_rq.GetSrvc() + "." + c.orig_rq.GetProcedure())
+	c.this_call.MachineName = pb.String(machine_name)
+	c.this_call.ReceivedTime = pb.Int64(time.Now().UnixNano() / 1000)
+
+	if c.orig_rq.GetQueueTime() > 0 {
+		c.this_call.QueueTime = c.orig_rq.QueueTime
+	}
+}
+
 // For half-external use, e.g. by the client package. Returns not nil when the current
 // call tree is traced.
 func (c *Context) GetTraceInfo() *proto.TraceInfo {
@@ -83,7 +131,42 @@ func (c *Context) GetClientId() string {
 	return c.orig_rq.GetCallerId()
 }
 
-// Get the absolute deadline requested by the caller.
+// Returns the value of a metadata entry sent by the client (see client.Request.SetMetadata()),
+// or "" if there is none.
+func (c *Context) GetMetadata(key string) string {
+	for _, kv := range c.orig_rq.GetMetadata() {
+		if kv.GetKey() == key {
+			return kv.GetValue()
+		}
+	}
+	return ""
+}
+
+// Returns all metadata entries sent by the client.
+func (c *Context) GetMetadataMap() map[string]string {
+	m := make(map[string]string, len(c.orig_rq.GetMetadata()))
+
+	for _, kv := range c.orig_rq.GetMetadata() {
+		m[kv.GetKey()] = kv.GetValue()
+	}
+	return m
+}
+
+// Set a metadata entry that is sent back to the client with the response. An existing entry
+// with the same key is replaced.
+func (c *Context) SetResponseMetadata(key, value string) {
+	for _, kv := range c.response_metadata {
+		if kv.GetKey() == key {
+			kv.Value = pb.String(value)
+			return
+		}
+	}
+	c.response_metadata = append(c.response_metadata, &proto.KeyValue{Key: pb.String(key), Value: pb.String(value)})
+}
+
+// Get the deadline requested by the caller, in local time; it is the zero time if the caller
+// didn't send a timeout. Child calls made with this context (see client.Request.SetContext())
+// are sent the time left as their timeout.
 func (c *Context) GetDeadline() time.Time {
 	return c.deadline
 }
@@ -93,6 +176,29 @@ func (c *Context) GetDeadlineNotifier() <-chan time.Time {
 	return time.After(c.deadline.Sub(time.Now()))
 }
 
+/*
+Returns a channel that is closed when the request is canceled, e.g. because the server is
+shutting down (see Server.Shutdown()). Long-running handlers should stop working then; the
+response is still sent if the handler returns within SHUTDOWN_GRACE_PERIOD.
+*/
+func (c *Context) Done() <-chan struct{} {
+	return c.done
+}
+
+// Whether the request has been canceled (see Done()).
+func (c *Context) Canceled() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Context) cancel() {
+	c.cancel_once.Do(func() { close(c.done) })
+}
+
 // Fail with msg as error message (sent back to the client)
 func (c *Context) Fail(msg string) {
 	c.failed = true
@@ -135,6 +241,8 @@ func (cx *Context) toRPCResponse() *proto.RPCResponse {
 		rpproto.ErrorMessage = pb.String(cx.error_message)
 	}
 
+	rpproto.Metadata = cx.response_metadata
+
 	// Tracing enabled
 	if cx.this_call != nil {
 		cx.this_call.RepliedTime = pb.Int64(time.Now().UnixNano() / 1000)
@@ -143,7 +251,10 @@ func (cx *Context) toRPCResponse() *proto.RPCResponse {
 			cx.this_call.ErrorMessage = pb.String(cx.error_message)
 		}
 
-		rpproto.Traceinfo = cx.this_call
+		// The trace may have been started only for sampling
+		if cx.orig_rq.GetWantTrace() {
+			rpproto.Traceinfo = cx.this_call
+		}
 	}
 
 	return rpproto
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func newMetadataTestContext(metadata map[string]string) *Context {
+	rq := &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Metadata"),
+		RpcId: pb.String("rpc1"), CallerId: pb.String("caller1")}
+
+	for k, v := range metadata {
+		rq.Metadata = append(rq.Metadata, &proto.KeyValue{Key: pb.String(k), Value: pb.String(v)})
+	}
+	return (&Server{}).newContext(rq, nil)
+}
+
+func TestGetMetadata(t *testing.T) {
+	cx := newMetadataTestContext(map[string]string{"user": "alice", "trace": "abc"})
+
+	if v := cx.GetMetadata("user"); v != "alice" {
+		t.Error("Unexpected value for user:", v)
+	}
+	if v := cx.GetMetadata("missing"); v != "" {
+		t.Error("Unexpected value for missing key:", v)
+	}
+
+	m := cx.GetMetadataMap()
+
+	if len(m) != 2 || m["user"] != "alice" || m["trace"] != "abc" {
+		t.Error("Unexpected metadata map:", m)
+	}
+}
+
+func TestGetMetadataMapEmpty(t *testing.T) {
+	cx := newMetadataTestContext(nil)
+
+	if m := cx.GetMetadataMap(); m == nil || len(m) != 0 {
+		t.Error("Expected empty map, got", m)
+	}
+}
+
+func TestSetResponseMetadata(t *testing.T) {
+	cx := newMetadataTestContext(nil)
+
+	cx.SetResponseMetadata("a", "1")
+	cx.SetResponseMetadata("b", "2")
+	cx.SetResponseMetadata("a", "3")
+	cx.Success([]byte("ok"))
+
+	rp := cx.toRPCResponse()
+
+	if len(rp.GetMetadata()) != 2 {
+		t.Fatal("Expected 2 metadata entries, got", rp.GetMetadata())
+	}
+	if kv := rp.GetMetadata()[0]; kv.GetKey() != "a" || kv.GetValue() != "3" {
+		t.Error("Entry wasn't replaced:", kv)
+	}
+	if kv := rp.GetMetadata()[1]; kv.GetKey() != "b" || kv.GetValue() != "2" {
+		t.Error("Unexpected entry:", kv)
+	}
+}
+
+func TestResponseMetadataOnFailure(t *testing.T) {
+	cx := newMetadataTestContext(nil)
+
+	cx.SetResponseMetadata("reason", "denied")
+	cx.Fail("not allowed")
+
+	rp := cx.toRPCResponse()
+
+	if rp.GetResponseStatus() != proto.RPCResponse_STATUS_NOT_OK {
+		t.Error("Unexpected status:", rp.GetResponseStatus())
+	}
+	if len(rp.GetMetadata()) != 1 || rp.GetMetadata()[0].GetValue() != "denied" {
+		t.Error("Metadata missing from failed response:", rp.GetMetadata())
+	}
+}
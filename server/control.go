@@ -0,0 +1,142 @@
+package server
+
+/*
+* The load balancer owns its state and its sockets, so other goroutines change them by sending
+* it commands: A command is queued on a channel, and the load balancer is woken up by a message
+* on an inproc socket that it polls together with the routers.
+ */
+
+import (
+	"errors"
+	"github.com/dermesser/clusterrpc/log"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+// Prefix of the command endpoint; like the backend router, it is unique per server.
+const COMMAND_PATH string = "inproc://rpc_lb_commands"
+
+// Commands waiting to be picked up by the load balancer
+const COMMAND_QUEUE_LENGTH int = 16
+
+// A function executed by the load balancer goroutine.
+type lbCommand func(lb *balancer)
+
+// Set up the command channel. The load balancer end is bound before anything connects to it.
+func (srv *Server) setupCommands() error {
+	var err error
+	srv.commands = make(chan lbCommand, COMMAND_QUEUE_LENGTH)
+	srv.command_pull, err = zmq.NewSocket(zmq.PULL)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when creating command socket:", err.Error())
+		return err
+	}
+
+	err = srv.command_pull.Bind(srv.command_path)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when binding command socket:", err.Error())
+		srv.command_pull.Close()
+		return err
+	}
+
+	srv.command_push, err = zmq.NewSocket(zmq.PUSH)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when creating command socket:", err.Error())
+		srv.command_pull.Close()
+		return err
+	}
+
+	err = srv.command_push.Connect(srv.command_path)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when connecting command socket:", err.Error())
+		srv.command_pull.Close()
+		srv.command_push.Close()
+		return err
+	}
+	return nil
+}
+
+/*
+Have the load balancer execute cmd. Returns once the command is queued, not when it has been
+executed; a command queued just before the load balancer stops is never executed, so callers
+waiting for it must also wait on srv.done. Returns an error if the load balancer has stopped
+or the server has been closed.
+*/
+func (srv *Server) sendCommand(cmd lbCommand) error {
+	srv.command_lock.Lock()
+	defer srv.command_lock.Unlock()
+
+	if srv.commands_closed {
+		return errors.New("Server has been closed")
+	}
+
+	select {
+	case <-srv.done:
+		return errors.New("Server has stopped")
+	default:
+	}
+
+	select {
+	case srv.commands <- cmd:
+	case <-srv.done:
+		return errors.New("Server has stopped")
+	}
+
+	// Wake up the load balancer
+	_, err := srv.command_push.SendBytes([]byte{}, 0)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not send command to load balancer:", err.Error())
+	}
+	return err
+}
+
+// Execute queued commands; called by the load balancer when woken up.
+func (srv *Server) handleCommands(lb *balancer) {
+	_, err := srv.command_pull.RecvBytes(0)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when receiving command:", err.Error())
+	}
+
+	for {
+		select {
+		case cmd := <-srv.commands:
+			cmd(lb)
+		default:
+			return
+		}
+	}
+}
+
+/*
+Execute f, which uses state owned by the load balancer: directly (with a nil balancer) if the
+load balancer isn't running yet, otherwise by the load balancer. Returns the error returned by f.
+*/
+func (srv *Server) onBalancer(f func(lb *balancer) error) error {
+	srv.state_lock.Lock()
+
+	if srv.State() == STATE_CREATED {
+		// Serve() waits for us
+		defer srv.state_lock.Unlock()
+		return f(nil)
+	}
+	srv.state_lock.Unlock()
+
+	result := make(chan error, 1)
+
+	if err := srv.sendCommand(func(lb *balancer) { result <- f(lb) }); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-srv.done:
+		return errors.New("Server has stopped")
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+/*
+* Deferred responses: A handler waiting for an external event can detach its Context and
+* return, freeing its worker. The response is sent later, from any goroutine, by calling
+* Respond() on the Context; it is routed to the client through the load balancer, which owns
+* the frontend socket. The endpoint's timeout still applies; the watchdog answers detached
+* requests that aren't responded to in time.
+ */
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Detach the Context from the handler: The worker doesn't send a response when the handler
+returns, but is free for the next request. Set the result as usual (Success(), Return() or
+Fail()) and send it with Respond() once it is available, from any goroutine. The Context
+must not be used by the handler after passing it on.
+
+The timeout of the endpoint (see HandlerTimeout()) still applies: If Respond() isn't called in
+time, the client receives STATUS_TIMEOUT, the Context is canceled and Respond() fails. As the
+worker is free, a detached request doesn't count against concurrency limits (see
+MaxConcurrent()) and the caller's quota anymore.
+
+Streaming requests can't be detached.
+*/
+func (c *Context) Detach() error {
+	if c.orig_rq.GetStreamId() != "" {
+		return errors.New("Streaming requests can't be detached")
+	}
+	if c.srv == nil || c.reply_to == nil {
+		return errors.New("Context can't be detached")
+	}
+
+	c.response_lock.Lock()
+	defer c.response_lock.Unlock()
+
+	if c.timed_out {
+		return errors.New("Request has timed out")
+	}
+	if !c.detached {
+		c.detached = true
+		atomic.AddInt64(&c.srv.stats.detached, 1)
+	}
+	return nil
+}
+
+/*
+Send the response of a detached Context to the client. Can only be called once. Returns an
+error if the request has timed out, the server has stopped or the response couldn't be routed
+to the client, e.g. because it has disconnected.
+*/
+func (c *Context) Respond() error {
+	c.response_lock.Lock()
+
+	if !c.detached {
+		c.response_lock.Unlock()
+		return errors.New("Context is not detached")
+	} else if c.timed_out {
+		c.response_lock.Unlock()
+		return errors.New("Request has timed out")
+	} else if c.responded {
+		c.response_lock.Unlock()
+		return errors.New("Response has already been sent")
+	}
+
+	c.responded = true
+	if c.watchdog != nil {
+		c.watchdog.Stop()
+	}
+	c.response_lock.Unlock()
+
+	srv := c.srv
+	defer atomic.AddInt64(&srv.stats.detached, -1)
+	defer srv.untrackContext(c)
+
+	// Nobody waits for the response.
+	if c.orig_rq.GetOneWay() {
+		return nil
+	}
+
+	rpproto := c.toRPCResponse()
+	rpproto.RpcId = c.orig_rq.RpcId
+	srv.compressResponse(c.orig_rq, rpproto)
+
+	buf, err := rpproto.Marshal()
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS,
+			fmt.Sprintf("[%x/%s/%s] Error when serializing deferred RPCResponse: %s",
+				c.reply_to.clientId, c.orig_rq.GetCallerId(), c.orig_rq.GetRpcId(), err.Error()))
+
+		rpproto = &proto.RPCResponse{RpcId: c.orig_rq.RpcId, ResponseStatus: proto.RPCResponse_STATUS_SERVER_ERROR.Enum()}
+		buf, _ = rpproto.Marshal()
+	}
+
+	message := newClientMessage(c.reply_to.requestId, c.reply_to.clientId, buf)
+
+	return srv.onFrontend(func() error {
+		_, err := srv.frontend_router.SendMessage(message.serializeClientMessage()) // [request identity, client identity, "", RPCResponse]
+
+		if err != nil {
+			log.CRPC_log(log.LOGLEVEL_WARNINGS,
+				fmt.Sprintf("[%x/%s/%s] Error when sending deferred response: %s",
+					c.reply_to.clientId, c.orig_rq.GetCallerId(), c.orig_rq.GetRpcId(), err.Error()))
+		}
+		return err
+	})
+}
+
+func (c *Context) isDetached() bool {
+	c.response_lock.Lock()
+	defer c.response_lock.Unlock()
+
+	return c.detached
+}
+
+/*
+Mark the request as timed out, unless its response has been sent already (returns false
+then). The caller answers with STATUS_TIMEOUT; a detached Context doesn't count as detached
+anymore.
+*/
+func (c *Context) timeOut() bool {
+	c.response_lock.Lock()
+	defer c.response_lock.Unlock()
+
+	if c.responded {
+		return false
+	}
+
+	c.responded, c.timed_out = true, true
+
+	if c.detached {
+		atomic.AddInt64(&c.srv.stats.detached, -1)
+	}
+	return true
+}
+
+// Answer a detached request with STATUS_TIMEOUT if Respond() isn't called within d.
+func (srv *Server) watchDetached(cx *Context, d time.Duration) {
+	cx.response_lock.Lock()
+	defer cx.response_lock.Unlock()
+
+	if cx.responded {
+		return
+	}
+
+	cx.watchdog = time.AfterFunc(d, func() {
+		if !cx.timeOut() {
+			return
+		}
+
+		atomic.AddUint64(&srv.stats.timed_out, 1)
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, fmt.Sprintf("[%x/%s/%s] Detached request to %s.%s wasn't answered within its timeout",
+			cx.reply_to.clientId, cx.orig_rq.GetCallerId(), cx.orig_rq.GetRpcId(), cx.orig_rq.GetSrvc(), cx.orig_rq.GetProcedure()))
+
+		cx.cancel()
+		srv.untrackContext(cx)
+
+		srv.onFrontend(func() error {
+			srv.sendError(srv.frontend_router, cx.orig_rq, proto.RPCResponse_STATUS_TIMEOUT, cx.reply_to)
+			return nil
+		})
+	})
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func newDeferredTestContext(srv *Server, rq *proto.RPCRequest) *Context {
+	cx := srv.newContext(rq, nil)
+	cx.reply_to = &workerRequest{clientId: []byte("client"), requestId: []byte("request")}
+	srv.trackContext(cx)
+	return cx
+}
+
+func newDeferredTestRequest() *proto.RPCRequest {
+	return &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Deferred"),
+		RpcId: pb.String("rpc1"), CallerId: pb.String("caller1")}
+}
+
+func TestDetachRefused(t *testing.T) {
+	srv := &Server{contexts: make(map[*Context]bool)}
+
+	rq := newDeferredTestRequest()
+	rq.StreamId = pb.String("stream1")
+
+	if err := newDeferredTestContext(srv, rq).Detach(); err == nil {
+		t.Error("Streaming request was detached")
+	}
+	if err := srv.newContext(newDeferredTestRequest(), nil).Detach(); err == nil {
+		t.Error("Context without worker request was detached")
+	}
+}
+
+func TestDetachAndRespond(t *testing.T) {
+	srv := &Server{contexts: make(map[*Context]bool)}
+
+	// One-way, so that Respond() doesn't send anything.
+	rq := newDeferredTestRequest()
+	rq.OneWay = pb.Bool(true)
+	cx := newDeferredTestContext(srv, rq)
+
+	if err := cx.Respond(); err == nil {
+		t.Error("Responded without detaching")
+	}
+
+	if err := cx.Detach(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cx.Detach(); err != nil {
+		t.Fatal(err)
+	}
+	if !cx.isDetached() || srv.stats.detached != 1 {
+		t.Fatal("Unexpected detached state:", cx.isDetached(), srv.stats.detached)
+	}
+
+	cx.Success([]byte("result"))
+
+	if err := cx.Respond(); err != nil {
+		t.Error("Respond failed:", err)
+	}
+	if srv.stats.detached != 0 || len(srv.contexts) != 0 {
+		t.Error("Context still counted:", srv.stats.detached, len(srv.contexts))
+	}
+	if err := cx.Respond(); err == nil {
+		t.Error("Responded twice")
+	}
+	if cx.timeOut() {
+		t.Error("Timed out after response")
+	}
+}
+
+func TestDetachedTimeout(t *testing.T) {
+	srv := &Server{contexts: make(map[*Context]bool)}
+	cx := newDeferredTestContext(srv, newDeferredTestRequest())
+
+	if err := cx.Detach(); err != nil {
+		t.Fatal(err)
+	}
+	if !cx.timeOut() {
+		t.Fatal("Couldn't time out")
+	}
+	if srv.stats.detached != 0 {
+		t.Error("Timed out Context still counted as detached")
+	}
+	if err := cx.Respond(); err == nil {
+		t.Error("Responded after timeout")
+	}
+	if cx.timeOut() {
+		t.Error("Timed out twice")
+	}
+}
+
+func TestDetachAfterTimeout(t *testing.T) {
+	srv := &Server{contexts: make(map[*Context]bool)}
+	cx := newDeferredTestContext(srv, newDeferredTestRequest())
+
+	if !cx.timeOut() {
+		t.Fatal("Couldn't time out")
+	}
+	if err := cx.Detach(); err == nil {
+		t.Error("Detached after timeout")
+	}
+	if srv.stats.detached != 0 {
+		t.Error("Unexpected detached count:", srv.stats.detached)
+	}
+}
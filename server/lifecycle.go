@@ -0,0 +1,151 @@
+package server
+
+/*
+* The lifecycle of a server: It is created (NewServer()), serves requests after Serve(), may
+* be put into lameduck mode, drains its requests on Shutdown() and is stopped in the end.
+* State changes are serialized by state_lock; the current state can be read at any time.
+ */
+
+import (
+	"errors"
+	"github.com/dermesser/clusterrpc/log"
+	"sync/atomic"
+)
+
+type State int32
+
+const (
+	// Created, but not serving yet
+	STATE_CREATED State = iota
+	// Serving requests
+	STATE_SERVING
+	// Serving requests, but failing health checks (see SetLameduck())
+	STATE_LAMEDUCK
+	// Not accepting new requests, but finishing queued and running ones (see Shutdown())
+	STATE_DRAINING
+	// Stopped; the server can't be started again
+	STATE_STOPPED
+)
+
+var state_names = map[State]string{
+	STATE_CREATED:  "CREATED",
+	STATE_SERVING:  "SERVING",
+	STATE_LAMEDUCK: "LAMEDUCK",
+	STATE_DRAINING: "DRAINING",
+	STATE_STOPPED:  "STOPPED",
+}
+
+func (s State) String() string {
+	return state_names[s]
+}
+
+// Called on every state change with the previous and the new state.
+type StateCallback func(from, to State)
+
+// Returns the current state of the server.
+func (srv *Server) State() State {
+	return State(atomic.LoadInt32(&srv.state))
+}
+
+/*
+Register a function that is called whenever the state of the server changes. Callbacks are
+called in the order of the state changes, from the goroutine causing the change; they must
+not change the state themselves (e.g. by calling SetLameduck()).
+*/
+func (srv *Server) OnStateChange(cb StateCallback) {
+	srv.state_lock.Lock()
+	defer srv.state_lock.Unlock()
+
+	srv.state_callbacks = append(srv.state_callbacks, cb)
+}
+
+// Change to state to if the server is in one of the states from. Returns false otherwise.
+func (srv *Server) transition(to State, from ...State) bool {
+	srv.state_lock.Lock()
+	defer srv.state_lock.Unlock()
+
+	current := srv.State()
+
+	for _, s := range from {
+		if s == current {
+			atomic.StoreInt32(&srv.state, int32(to))
+
+			log.CRPC_log(log.LOGLEVEL_INFO, "Server state changed from", current.String(), "to", to.String())
+
+			for _, cb := range srv.state_callbacks {
+				cb(current, to)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Start the load balancer and the workers and return. Returns an error if any worker couldn't
+set up its socket, or if the server has already been started.
+Use Wait() or Done() to find out when the server has stopped.
+*/
+func (srv *Server) Serve() error {
+	to := STATE_SERVING
+	if srv.isLameduck() {
+		to = STATE_LAMEDUCK
+	}
+
+	if !srv.transition(to, STATE_CREATED) {
+		return errors.New("Server has already been started")
+	}
+
+	go srv.loadbalance()
+
+	var i uint
+	for i = 0; i < srv.workers; i++ {
+		err := srv.thread(i, true)
+
+		if err != nil {
+			srv.exit(err)
+			srv.stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// Block until the server has stopped. Returns the error that caused it to stop, if any.
+func (srv *Server) Wait() error {
+	<-srv.done
+
+	srv.state_lock.Lock()
+	defer srv.state_lock.Unlock()
+
+	return srv.exit_err
+}
+
+// Returns a channel that is closed once the server has stopped.
+func (srv *Server) Done() <-chan struct{} {
+	return srv.done
+}
+
+// Record why the server stops; the first error is kept.
+func (srv *Server) exit(err error) {
+	srv.state_lock.Lock()
+	defer srv.state_lock.Unlock()
+
+	if srv.exit_err == nil {
+		srv.exit_err = err
+	}
+}
+
+// Called when the load balancer has stopped, or when a server is stopped before serving.
+func (srv *Server) stopped() {
+	srv.transition(STATE_STOPPED, STATE_CREATED, STATE_SERVING, STATE_LAMEDUCK, STATE_DRAINING)
+	srv.done_once.Do(func() { close(srv.done) })
+}
+
+func (srv *Server) isLameduck() bool {
+	return atomic.LoadUint32(&srv.lameduck_state) == 1
+}
+
+func (srv *Server) isLoadshed() bool {
+	return atomic.LoadUint32(&srv.loadshed_state) == 1
+}
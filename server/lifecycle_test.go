@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func newLifecycleTestServer() *Server {
+	return &Server{done: make(chan struct{})}
+}
+
+func TestStateNames(t *testing.T) {
+	if s := STATE_LAMEDUCK.String(); s != "LAMEDUCK" {
+		t.Error("Unexpected name:", s)
+	}
+	if s := STATE_STOPPED.String(); s != "STOPPED" {
+		t.Error("Unexpected name:", s)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	srv := newLifecycleTestServer()
+	var changes [][2]State
+
+	srv.OnStateChange(func(from, to State) {
+		changes = append(changes, [2]State{from, to})
+	})
+
+	if srv.State() != STATE_CREATED {
+		t.Fatal("Unexpected initial state:", srv.State())
+	}
+	if srv.transition(STATE_DRAINING, STATE_SERVING, STATE_LAMEDUCK) {
+		t.Error("Transition from wrong state succeeded")
+	}
+	if !srv.transition(STATE_SERVING, STATE_CREATED) {
+		t.Error("Transition failed")
+	}
+	if srv.State() != STATE_SERVING {
+		t.Error("Unexpected state:", srv.State())
+	}
+
+	if len(changes) != 1 || changes[0] != [2]State{STATE_CREATED, STATE_SERVING} {
+		t.Error("Unexpected callbacks:", changes)
+	}
+}
+
+func TestSetLameduckState(t *testing.T) {
+	srv := newLifecycleTestServer()
+
+	// Before serving, only the flag is set.
+	srv.SetLameduck(true)
+
+	if srv.State() != STATE_CREATED || !srv.isLameduck() {
+		t.Error("Unexpected state:", srv.State(), srv.isLameduck())
+	}
+
+	srv.transition(STATE_SERVING, STATE_CREATED)
+	srv.SetLameduck(true)
+
+	if srv.State() != STATE_LAMEDUCK {
+		t.Error("Unexpected state:", srv.State())
+	}
+
+	srv.SetLameduck(false)
+
+	if srv.State() != STATE_SERVING || srv.isLameduck() {
+		t.Error("Unexpected state:", srv.State(), srv.isLameduck())
+	}
+
+	// A draining server stays draining.
+	srv.transition(STATE_DRAINING, STATE_SERVING)
+	srv.SetLameduck(true)
+
+	if srv.State() != STATE_DRAINING {
+		t.Error("Unexpected state:", srv.State())
+	}
+}
+
+func TestStoppedAndWait(t *testing.T) {
+	srv := newLifecycleTestServer()
+	srv.transition(STATE_SERVING, STATE_CREATED)
+
+	first := errors.New("first")
+	srv.exit(first)
+	srv.exit(errors.New("second"))
+
+	select {
+	case <-srv.Done():
+		t.Fatal("Done before stopping")
+	default:
+	}
+
+	srv.stopped()
+	srv.stopped()
+
+	if srv.State() != STATE_STOPPED {
+		t.Error("Unexpected state:", srv.State())
+	}
+	if err := srv.Wait(); err != first {
+		t.Error("Unexpected error:", err)
+	}
+	if srv.transition(STATE_SERVING, STATE_CREATED) {
+		t.Error("Stopped server could be started again")
+	}
+}
@@ -50,10 +50,10 @@ func logProtobuf(p pb.Message) string {
 }
 
 func (ctx *Context) connIdString(size int) string {
-	dead_left := (ctx.orig_rq.GetDeadline() / 1000) - (time.Now().UnixNano() / 1000000)
+	var dead_left int64
 
-	if ctx.orig_rq.GetDeadline() == 0 {
-		dead_left = 0
+	if !ctx.deadline.IsZero() {
+		dead_left = int64(ctx.deadline.Sub(time.Now()) / time.Millisecond)
 	}
 
 	return fmt.Sprintf("%s.%s %s/%s %d B [%d ms left]", ctx.orig_rq.GetSrvc(), ctx.orig_rq.GetProcedure(),
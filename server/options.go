@@ -0,0 +1,143 @@
+package server
+
+import (
+	"time"
+
+	zmq "github.com/pebbe/zmq4"
+)
+
+/*
+Tuning of the frontend socket of a server. Zero values mean the ZeroMQ
+default, except where noted. Pass ServerOption functions to the constructors (e.g. NewServer());
+DefaultServerOptions() has the settings used if none are given.
+*/
+type ServerOptions struct {
+	// Send/receive timeout of the load balancer's sockets (0 = no timeout)
+	Timeout time.Duration
+	// Maximum number of messages queued per connection, per direction
+	SendHWM, ReceiveHWM int
+	// Enable TCP keepalive; idle time before the first probe and time between probes
+	TCPKeepalive                           bool
+	TCPKeepaliveIdle, TCPKeepaliveInterval time.Duration
+	// ZMTP heartbeats: A PING is sent every HeartbeatInterval; a peer that doesn't respond
+	// within HeartbeatTimeout is considered dead and disconnected. Requires ZeroMQ 4.2.
+	HeartbeatInterval, HeartbeatTimeout time.Duration
+	// Peers sending larger messages are disconnected
+	MaxMessageSize int64
+	// Accept IPv6 connections (default true)
+	IPv6 bool
+}
+
+type ServerOption func(*ServerOptions)
+
+func DefaultServerOptions() ServerOptions {
+	return ServerOptions{Timeout: 3 * time.Second, IPv6: true}
+}
+
+// Set the send/receive timeout of the load balancer's sockets (see also SetTimeout()).
+func SocketTimeout(d time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.Timeout = d
+	}
+}
+
+// Set the high-water marks for sending and receiving, in messages per connection.
+func HWM(send, receive int) ServerOption {
+	return func(o *ServerOptions) {
+		o.SendHWM, o.ReceiveHWM = send, receive
+	}
+}
+
+// Enable TCP keepalive, sending probes after idle and then every interval (0 = system default).
+// Both are rounded up to whole seconds.
+func TCPKeepalive(idle, interval time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.TCPKeepalive = true
+		o.TCPKeepaliveIdle, o.TCPKeepaliveInterval = idle, interval
+	}
+}
+
+// Enable ZMTP heartbeats for detecting dead clients.
+func Heartbeat(interval, timeout time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.HeartbeatInterval, o.HeartbeatTimeout = interval, timeout
+	}
+}
+
+// Disconnect clients sending messages larger than n bytes.
+func MaxMessageSize(n int64) ServerOption {
+	return func(o *ServerOptions) {
+		o.MaxMessageSize = n
+	}
+}
+
+// Enable or disable IPv6.
+func IPv6(enable bool) ServerOption {
+	return func(o *ServerOptions) {
+		o.IPv6 = enable
+	}
+}
+
+func makeServerOptions(opts []ServerOption) ServerOptions {
+	o := DefaultServerOptions()
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// Apply the options to a socket. Must be called before binding it. Returns the first error.
+func (o *ServerOptions) apply(sock *zmq.Socket) error {
+	var err error
+	set := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+
+	set(sock.SetIpv6(o.IPv6))
+	set(sock.SetSndtimeo(zmqTimeout(o.Timeout)))
+	set(sock.SetRcvtimeo(zmqTimeout(o.Timeout)))
+
+	if o.SendHWM > 0 {
+		set(sock.SetSndhwm(o.SendHWM))
+	}
+	if o.ReceiveHWM > 0 {
+		set(sock.SetRcvhwm(o.ReceiveHWM))
+	}
+	if o.TCPKeepalive {
+		set(sock.SetTcpKeepalive(1))
+
+		if o.TCPKeepaliveIdle > 0 {
+			set(sock.SetTcpKeepaliveIdle(keepaliveSeconds(o.TCPKeepaliveIdle)))
+		}
+		if o.TCPKeepaliveInterval > 0 {
+			set(sock.SetTcpKeepaliveIntvl(keepaliveSeconds(o.TCPKeepaliveInterval)))
+		}
+	}
+	if o.HeartbeatInterval > 0 {
+		set(sock.SetHeartbeatIvl(o.HeartbeatInterval))
+	}
+	if o.HeartbeatTimeout > 0 {
+		set(sock.SetHeartbeatTimeout(o.HeartbeatTimeout))
+	}
+	if o.MaxMessageSize > 0 {
+		set(sock.SetMaxmsgsize(o.MaxMessageSize))
+	}
+	return err
+}
+
+// The TCP keepalive options have a resolution of seconds; d is rounded up, so that sub-second
+// values don't turn into 0 (i.e. the system default).
+func keepaliveSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// ZeroMQ treats a timeout of 0 as "don't block"; here, 0 means the ZeroMQ default (-1, no timeout).
+func zmqTimeout(d time.Duration) time.Duration {
+	if d == 0 {
+		return -1
+	}
+	return d
+}
@@ -0,0 +1,387 @@
+package server
+
+/*
+* This file implements a proxy that accepts RPCs on a single frontend and forwards them,
+* by service name, to pools of backend servers. It is used by the crpc-proxy command.
+ */
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	smgr "github.com/dermesser/clusterrpc/securitymanager"
+	"time"
+
+	pb "github.com/gogo/protobuf/proto"
+	zmq "github.com/pebbe/zmq4"
+)
+
+// Service name under which the default backend pool is registered.
+const PROXY_DEFAULT_POOL string = "*"
+
+// A request that has been forwarded and waits for its response.
+type proxiedRequest struct {
+	message  clientMessage
+	received time.Time
+	endpoint string
+	// Whether to add a hop to the trace
+	want_trace bool
+}
+
+/*
+A Proxy accepts requests on a ROUTER socket and forwards them to backend pools, chosen by
+RPCRequest.srvc. Each pool is a DEALER socket connected to all backends of the pool, so that
+requests are distributed round-robin. Requests and responses are forwarded unchanged, except
+that the timeout budget of requests is reduced by the time spent in the proxy, and traced calls
+get an additional hop in their TraceInfo.
+
+Streams are not supported, as all messages of a stream must reach the same backend; stream
+requests are answered with STATUS_NOT_SUPPORTED.
+*/
+type Proxy struct {
+	frontend *zmq.Socket
+	pools    map[string]*zmq.Socket
+
+	pending map[uint64]proxiedRequest
+	next_id uint64
+
+	// How long to wait for a response from a backend
+	timeout      time.Duration
+	machine_name string
+}
+
+/*
+Create a proxy listening on the given URLs (e.g. tcp://*:9000 or ipc:///tmp/proxy.sock).
+security_manager may be nil; it applies only to the frontend.
+*/
+func NewProxy(bindurls []string, security_manager *smgr.ServerSecurityManager) (*Proxy, error) {
+	p := &Proxy{pools: make(map[string]*zmq.Socket), pending: make(map[uint64]proxiedRequest),
+		timeout: 30 * time.Second}
+
+	var err error
+	p.frontend, err = zmq.NewSocket(zmq.ROUTER)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when creating proxy frontend socket:", err.Error())
+		return nil, err
+	}
+
+	p.frontend.SetIpv6(true)
+	p.frontend.SetRouterMandatory(1)
+	p.frontend.SetLinger(0)
+
+	err = security_manager.ApplyToServerSocket(p.frontend)
+
+	if err != nil {
+		p.frontend.Close()
+		return nil, err
+	}
+
+	for _, bindurl := range bindurls {
+		log.CRPC_log(log.LOGLEVEL_INFO, "Binding proxy frontend to", bindurl)
+		err = p.frontend.Bind(bindurl)
+
+		if err != nil {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when binding proxy frontend:", err.Error())
+			p.frontend.Close()
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+/*
+Forward requests for service to the given backends (URLs like tcp://host:port). Use
+PROXY_DEFAULT_POOL as service for requests to services without a pool of their own. Can be
+called several times for the same service to add backends. security_manager may be nil; it
+is only applied when the pool is created (i.e. on the first call for service).
+*/
+func (p *Proxy) AddBackends(service string, backends []string, security_manager *smgr.ClientSecurityManager) error {
+	pool, ok := p.pools[service]
+
+	if !ok {
+		var err error
+		pool, err = zmq.NewSocket(zmq.DEALER)
+
+		if err != nil {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when creating backend socket:", err.Error())
+			return err
+		}
+
+		err = security_manager.ApplyToClientSocket(pool)
+
+		if err != nil {
+			pool.Close()
+			return err
+		}
+
+		pool.SetIpv6(true)
+		pool.SetLinger(0)
+		pool.SetImmediate(true)
+		pool.SetReconnectIvl(100 * time.Millisecond)
+
+		p.pools[service] = pool
+	}
+
+	for _, backend := range backends {
+		log.CRPC_log(log.LOGLEVEL_INFO, "Proxy: Connecting pool", service, "to", backend)
+		err := pool.Connect(backend)
+
+		if err != nil {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not connect to backend", backend, ":", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// Set the time after which the proxy forgets about forwarded requests (default 30s).
+func (p *Proxy) SetTimeout(d time.Duration) {
+	p.timeout = d
+}
+
+// Set the machine name as shown in traces.
+func (p *Proxy) SetMachineName(name string) {
+	p.machine_name = name
+}
+
+// Close all sockets.
+func (p *Proxy) Close() {
+	p.frontend.Close()
+	for _, pool := range p.pools {
+		pool.Close()
+	}
+}
+
+// Forward requests and responses. Blocks forever unless an error occurs.
+func (p *Proxy) Run() error {
+	if len(p.pools) == 0 {
+		return errors.New("No backends configured")
+	}
+
+	poller := zmq.NewPoller()
+	poller.Add(p.frontend, zmq.POLLIN)
+	for _, pool := range p.pools {
+		poller.Add(pool, zmq.POLLIN)
+	}
+
+	for {
+		polled, err := poller.Poll(time.Second)
+
+		if err != nil {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Polling error in proxy:", err.Error())
+			return err
+		}
+
+		for _, sock := range polled {
+			if sock.Socket == p.frontend {
+				p.handleRequest()
+			} else {
+				p.handleResponse(sock.Socket)
+			}
+		}
+
+		p.expire()
+	}
+}
+
+func (p *Proxy) handleRequest() {
+	msgs, err := p.frontend.RecvMessageBytes(0)
+	received := time.Now()
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when receiving from proxy frontend:", err.Error())
+		return
+	}
+
+	if len(msgs) != 4 {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Proxy: Dropped message with", len(msgs), "frames")
+		return
+	}
+
+	message := parseClientMessage(msgs)
+	request := new(proto.RPCRequest)
+	err = request.Unmarshal(message.payload)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Proxy: Dropped message; could not decode protobuf:", err.Error())
+		return
+	}
+
+	if err = proxyable(request); err != nil {
+		p.sendError(message, request, proto.RPCResponse_STATUS_NOT_SUPPORTED, err.Error())
+		return
+	}
+
+	if deadlinePassed(requestDeadline(request, received), time.Now()) {
+		p.sendError(message, request, proto.RPCResponse_STATUS_MISSED_DEADLINE, "Deadline passed before reaching proxy")
+		return
+	}
+
+	pool, ok := p.pools[request.GetSrvc()]
+
+	if !ok {
+		if pool, ok = p.pools[PROXY_DEFAULT_POOL]; !ok {
+			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Proxy: No backends for service", request.GetSrvc())
+			p.sendError(message, request, proto.RPCResponse_STATUS_NOT_FOUND, "No backends for service "+request.GetSrvc())
+			return
+		}
+	}
+
+	payload := message.payload
+
+	// The budget counts from when the backend receives the request.
+	if request.TimeoutBudget != nil {
+		if !deductBudget(request, time.Now().Sub(received)) {
+			p.sendError(message, request, proto.RPCResponse_STATUS_MISSED_DEADLINE, "Deadline passed in proxy")
+			return
+		}
+		if payload, err = request.Marshal(); err != nil {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Proxy: Error when serializing RPCRequest:", err.Error())
+			p.sendError(message, request, proto.RPCResponse_STATUS_SERVER_ERROR, "Could not serialize request")
+			return
+		}
+	}
+
+	id := p.next_id
+	p.next_id++
+
+	// The backend sees the proxy as a REQ client with correlation; it returns the ID frame to us.
+	id_frame := make([]byte, 8)
+	binary.BigEndian.PutUint64(id_frame, id)
+
+	_, err = pool.SendMessageDontwait(id_frame, []byte{}, payload)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Proxy: Could not forward request for", request.GetSrvc(), ":", err.Error())
+		p.sendError(message, request, proto.RPCResponse_STATUS_OVERLOADED_RETRY, "No backend available")
+		return
+	}
+
+	p.track(id, message, request, received)
+}
+
+// Subtract elapsed from the timeout budget of request. Returns false if no budget is left.
+func deductBudget(request *proto.RPCRequest, elapsed time.Duration) bool {
+	budget := request.GetTimeoutBudget() - int64(elapsed/time.Microsecond)
+
+	if budget <= 0 {
+		return false
+	}
+	request.TimeoutBudget = pb.Int64(budget)
+	return true
+}
+
+// Remember a forwarded request until its response arrives. Backends don't respond to one-way
+// requests, so these are not tracked.
+func (p *Proxy) track(id uint64, message clientMessage, request *proto.RPCRequest, received time.Time) {
+	if request.GetOneWay() {
+		return
+	}
+	p.pending[id] = proxiedRequest{message: message, received: received,
+		endpoint: request.GetSrvc() + "." + request.GetProcedure(), want_trace: request.GetWantTrace()}
+}
+
+func (p *Proxy) handleResponse(pool *zmq.Socket) {
+	msgs, err := pool.RecvMessageBytes(0) // [id, "", RPCResponse]
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when receiving from backend:", err.Error())
+		return
+	}
+
+	if len(msgs) != 3 || len(msgs[0]) != 8 {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Proxy: Dropped backend message with unexpected format")
+		return
+	}
+
+	id := binary.BigEndian.Uint64(msgs[0])
+	rq, ok := p.pending[id]
+
+	if !ok {
+		log.CRPC_log(log.LOGLEVEL_INFO, "Proxy: Dropped response to expired request", id)
+		return
+	}
+	delete(p.pending, id)
+
+	payload := msgs[2]
+
+	if rq.want_trace {
+		payload = p.addTraceHop(rq, payload)
+	}
+
+	_, err = p.frontend.SendMessage(newClientMessage(rq.message.requestId, rq.message.clientId, payload).serializeClientMessage())
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Proxy: Could not route response to", fmt.Sprintf("%x", rq.message.clientId), ":", err.Error())
+	}
+}
+
+// Returns an error if request can't be forwarded by a proxy.
+func proxyable(request *proto.RPCRequest) error {
+	if request.StreamId != nil {
+		return errors.New("Streams can't be forwarded by crpc-proxy")
+	}
+	return nil
+}
+
+// Wraps the backend's trace into one describing the proxy. Returns payload unchanged on errors.
+func (p *Proxy) addTraceHop(rq proxiedRequest, payload []byte) []byte {
+	response := new(proto.RPCResponse)
+
+	if err := response.Unmarshal(payload); err != nil {
+		return payload
+	}
+
+	hop := new(proto.TraceInfo)
+	hop.ReceivedTime = pb.Int64(rq.received.UnixNano() / 1000)
+	hop.RepliedTime = pb.Int64(time.Now().UnixNano() / 1000)
+	hop.MachineName = pb.String(p.machine_name)
+	hop.EndpointName = pb.String("crpc-proxy:" + rq.endpoint)
+	if response.Traceinfo != nil {
+		hop.ChildCalls = []*proto.TraceInfo{response.Traceinfo}
+	}
+	response.Traceinfo = hop
+
+	new_payload, err := response.Marshal()
+
+	if err != nil {
+		return payload
+	}
+	return new_payload
+}
+
+// Forget about requests that didn't get a response in time.
+func (p *Proxy) expire() {
+	now := time.Now()
+
+	for id, rq := range p.pending {
+		if now.Sub(rq.received) > p.timeout {
+			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Proxy: No response from backend for", rq.endpoint, "within", p.timeout)
+			delete(p.pending, id)
+		}
+	}
+}
+
+func (p *Proxy) sendError(message clientMessage, request *proto.RPCRequest, s proto.RPCResponse_Status, error_message string) {
+	// Nobody waits for the response to a one-way request.
+	if request.GetOneWay() {
+		return
+	}
+
+	response := new(proto.RPCResponse)
+	response.RpcId = request.RpcId
+	response.ResponseStatus = s.Enum()
+	response.ErrorMessage = pb.String(error_message)
+
+	buf, err := response.Marshal()
+
+	if err != nil {
+		return
+	}
+
+	p.frontend.SendMessage(newClientMessage(message.requestId, message.clientId, buf).serializeClientMessage())
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func TestProxyRejectsStreams(t *testing.T) {
+	unary := &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Unary")}
+
+	if err := proxyable(unary); err != nil {
+		t.Fatal("unary request rejected:", err)
+	}
+
+	open := &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Stream"),
+		StreamId: pb.String("s1"), StreamCredit: pb.Uint32(4)}
+	message := &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Stream"),
+		StreamId: pb.String("s1"), StreamMessage: pb.Bool(true)}
+	credit := &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Stream"),
+		StreamId: pb.String("s1"), StreamCredit: pb.Uint32(1)}
+
+	for _, rq := range []*proto.RPCRequest{open, message, credit} {
+		if proxyable(rq) == nil {
+			t.Error("stream request accepted:", rq)
+		}
+	}
+}
+
+func TestProxyDoesntTrackOneWayRequests(t *testing.T) {
+	p := &Proxy{pending: make(map[uint64]proxiedRequest)}
+
+	p.track(1, clientMessage{}, &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Unary")},
+		time.Now())
+	p.track(2, clientMessage{}, &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Unary"),
+		OneWay: pb.Bool(true)}, time.Now())
+
+	if _, ok := p.pending[1]; !ok {
+		t.Error("request not tracked")
+	}
+	if _, ok := p.pending[2]; ok {
+		t.Error("one-way request tracked")
+	}
+}
+
+func TestProxyDeductsTimeoutBudget(t *testing.T) {
+	rq := &proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Unary"),
+		TimeoutBudget: pb.Int64(int64(100 * time.Millisecond / time.Microsecond))}
+
+	if !deductBudget(rq, 30*time.Millisecond) {
+		t.Fatal("budget exhausted too early")
+	}
+	if rq.GetTimeoutBudget() != int64(70*time.Millisecond/time.Microsecond) {
+		t.Fatal("unexpected budget:", rq.GetTimeoutBudget())
+	}
+	if deductBudget(rq, 70*time.Millisecond) {
+		t.Fatal("exhausted budget not detected")
+	}
+}
+
+func TestProxyAddsTraceHop(t *testing.T) {
+	p := &Proxy{machine_name: "proxy1"}
+	rq := proxiedRequest{received: time.Now(), endpoint: "Test.Unary", want_trace: true}
+
+	backend := &proto.TraceInfo{ReceivedTime: pb.Int64(1), RepliedTime: pb.Int64(2), EndpointName: pb.String("Test.Unary")}
+	payload, err := (&proto.RPCResponse{ResponseStatus: proto.RPCResponse_STATUS_OK.Enum(), Traceinfo: backend}).Marshal()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := new(proto.RPCResponse)
+	if err = response.Unmarshal(p.addTraceHop(rq, payload)); err != nil {
+		t.Fatal(err)
+	}
+
+	hop := response.GetTraceinfo()
+
+	if hop.GetMachineName() != "proxy1" || hop.GetEndpointName() != "crpc-proxy:Test.Unary" {
+		t.Error("unexpected hop:", hop)
+	}
+	if len(hop.GetChildCalls()) != 1 || hop.GetChildCalls()[0].GetEndpointName() != "Test.Unary" {
+		t.Error("backend trace missing:", hop.GetChildCalls())
+	}
+
+	if garbage := []byte{0xff, 0xff}; string(p.addTraceHop(rq, garbage)) != string(garbage) {
+		t.Error("undecodable payload changed")
+	}
+}
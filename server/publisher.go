@@ -0,0 +1,134 @@
+package server
+
+import (
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	smgr "github.com/dermesser/clusterrpc/securitymanager"
+	"sync"
+	"time"
+
+	pb "github.com/gogo/protobuf/proto"
+	zmq "github.com/pebbe/zmq4"
+)
+
+/*
+A Publisher sends messages on topics to all connected subscribers (see client.Subscriber).
+Every message carries a per-topic sequence number, so that subscribers can detect lost
+messages and resync, e.g. by calling an RPC endpoint that returns the current state
+together with Sequence().
+
+A Publisher is safe for concurrent use.
+*/
+type Publisher struct {
+	mx        sync.Mutex
+	sock      *zmq.Socket
+	sequences map[string]uint64
+}
+
+/*
+Create a standalone publisher bound to the given URLs (e.g. tcp://*:9001).
+security_manager may be nil; otherwise CURVE is used like for a Server.
+*/
+func NewPublisher(bindurls []string, security_manager *smgr.ServerSecurityManager) (*Publisher, error) {
+	p := &Publisher{sequences: make(map[string]uint64)}
+
+	var err error
+	p.sock, err = zmq.NewSocket(zmq.PUB)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when creating PUB socket:", err.Error())
+		return nil, err
+	}
+
+	p.sock.SetIpv6(true)
+	p.sock.SetLinger(0)
+
+	err = security_manager.ApplyToServerSocket(p.sock)
+
+	if err != nil {
+		p.sock.Close()
+		return nil, err
+	}
+
+	for _, bindurl := range bindurls {
+		log.CRPC_log(log.LOGLEVEL_INFO, "Binding publisher to", bindurl)
+		err = p.sock.Bind(bindurl)
+
+		if err != nil {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when binding PUB socket:", err.Error())
+			p.sock.Close()
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+/*
+Create a publisher attached to this server: It uses the server's security manager and is
+closed together with the server.
+*/
+func (srv *Server) NewPublisher(bindurls []string) (*Publisher, error) {
+	p, err := NewPublisher(bindurls, srv.security_manager)
+
+	if err != nil {
+		return nil, err
+	}
+
+	srv.publishers = append(srv.publishers, p)
+	return p, nil
+}
+
+// Send data to all subscribers of topic (or a prefix of it).
+func (p *Publisher) Publish(topic string, data []byte) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	msg := new(proto.PubSubMessage)
+	msg.Topic = pb.String(topic)
+	msg.Sequence = pb.Uint64(p.sequences[topic] + 1)
+	msg.Data = data
+	msg.PublishedTime = pb.Int64(time.Now().UnixNano() / 1000)
+
+	buf, err := msg.Marshal()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = p.sock.SendMessage(topic, buf)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Could not publish message on", topic, ":", err.Error())
+		return err
+	}
+
+	p.sequences[topic] = msg.GetSequence()
+	return nil
+}
+
+// Publish a serialized protocol buffer.
+func (p *Publisher) PublishProto(topic string, msg pb.Message) error {
+	buf, err := pb.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+	return p.Publish(topic, buf)
+}
+
+// Returns the sequence number of the last message published on topic (0 if none).
+func (p *Publisher) Sequence(topic string) uint64 {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return p.sequences[topic]
+}
+
+// Close the publisher's socket.
+func (p *Publisher) Close() {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	p.sock.Close()
+}
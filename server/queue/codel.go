@@ -0,0 +1,66 @@
+package queue
+
+import "time"
+
+// Default interval over which Codel evaluates queueing delays.
+const DEFAULT_CODEL_INTERVAL = 100 * time.Millisecond
+
+/*
+Codel implements CoDel-style overload detection for a request queue: If even the shortest
+queueing delay seen during an interval exceeds the target, the queue is not just absorbing
+a burst but is standing, i.e. the server is overloaded. While it is, requests that waited
+longer than the target are dropped, and new requests should be refused instead of queued.
+
+Codel is not safe for concurrent use.
+*/
+type Codel struct {
+	target, interval time.Duration
+
+	interval_end time.Time
+	// Shortest delay seen in the current interval; -1 if none
+	min_delay  time.Duration
+	overloaded bool
+}
+
+func NewCodel(target, interval time.Duration) *Codel {
+	if interval <= 0 {
+		interval = DEFAULT_CODEL_INTERVAL
+	}
+	return &Codel{target: target, interval: interval, min_delay: -1}
+}
+
+/*
+Record the queueing delay of a request taken from the queue (0 for requests that didn't have
+to wait). Returns true if the request should be dropped.
+*/
+func (c *Codel) Dequeued(delay time.Duration, now time.Time) bool {
+	if now.After(c.interval_end) {
+		if c.min_delay >= 0 {
+			c.overloaded = c.min_delay > c.target
+		}
+		c.min_delay = delay
+		c.interval_end = now.Add(c.interval)
+	} else if c.min_delay < 0 || delay < c.min_delay {
+		c.min_delay = delay
+	}
+
+	return c.overloaded && delay > c.target
+}
+
+// Whether the queue is currently considered overloaded.
+func (c *Codel) Overloaded() bool {
+	return c.overloaded
+}
+
+// Shortest queueing delay seen in the current interval.
+func (c *Codel) MinDelay() time.Duration {
+	if c.min_delay < 0 {
+		return 0
+	}
+	return c.min_delay
+}
+
+// Suggested time for clients to wait before retrying a refused request.
+func (c *Codel) RetryAfter() time.Duration {
+	return c.interval
+}
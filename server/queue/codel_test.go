@@ -0,0 +1,56 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCodelBurst(t *testing.T) {
+	c := NewCodel(5*time.Millisecond, 100*time.Millisecond)
+	now := time.Now()
+
+	// Long delays, but the queue drains in between
+	for i := 0; i < 10; i++ {
+		now = now.Add(30 * time.Millisecond)
+
+		if c.Dequeued(50*time.Millisecond, now) || c.Dequeued(0, now) {
+			t.Fatal("Dropped request during burst")
+		}
+	}
+	if c.Overloaded() {
+		t.Fatal("Overloaded after burst")
+	}
+}
+
+func TestCodelStandingQueue(t *testing.T) {
+	c := NewCodel(5*time.Millisecond, 100*time.Millisecond)
+	now := time.Now()
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(30 * time.Millisecond)
+		c.Dequeued(20*time.Millisecond, now)
+	}
+	if !c.Overloaded() {
+		t.Fatal("Not overloaded with standing queue")
+	}
+	if c.MinDelay() != 20*time.Millisecond {
+		t.Error("Wrong minimum delay:", c.MinDelay())
+	}
+
+	now = now.Add(30 * time.Millisecond)
+	if !c.Dequeued(20*time.Millisecond, now) {
+		t.Error("Request above target not dropped")
+	}
+	if c.Dequeued(time.Millisecond, now) {
+		t.Error("Request below target dropped")
+	}
+
+	// The queue has drained; recovers after the next interval
+	for i := 0; i < 10; i++ {
+		now = now.Add(30 * time.Millisecond)
+		c.Dequeued(0, now)
+	}
+	if c.Overloaded() {
+		t.Fatal("Still overloaded after queue drained")
+	}
+}
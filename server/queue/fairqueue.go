@@ -0,0 +1,138 @@
+package queue
+
+/*
+A FairQueue holds elements of several flows (identified by a key, e.g. the caller), each in
+FIFO order. Elements are taken from the flows in round-robin order (deficit round-robin with
+equal costs), so that a flow with many elements can't delay the elements of other flows
+by more than one element per flow.
+*/
+type FairQueue struct {
+	flows map[string]*flow
+	// Keys of non-empty flows, in round-robin order; next is the index of the next flow to serve
+	active []string
+	next   int
+	l      int
+}
+
+type flow struct {
+	elems []interface{}
+}
+
+func NewFairQueue() FairQueue {
+	return FairQueue{flows: make(map[string]*flow)}
+}
+
+// Number of elements in all flows.
+func (q *FairQueue) Len() int {
+	return q.l
+}
+
+// Number of elements in one flow.
+func (q *FairQueue) FlowLen(key string) int {
+	if f, ok := q.flows[key]; ok {
+		return len(f.elems)
+	}
+	return 0
+}
+
+// Append to the back of a flow.
+func (q *FairQueue) Push(key string, e interface{}) {
+	f, ok := q.flows[key]
+
+	if !ok {
+		f = new(flow)
+		q.flows[key] = f
+		// New flows are served last in the current round
+		q.active = append(q.active, key)
+	}
+	f.elems = append(f.elems, e)
+	q.l++
+}
+
+// Get the oldest element of the next flow. May return nil if queue is empty.
+func (q *FairQueue) Pop() interface{} {
+	return q.take(false)
+}
+
+// Get the newest element of the next flow. May return nil if queue is empty.
+func (q *FairQueue) PopBack() interface{} {
+	return q.take(true)
+}
+
+// Remove the newest element of the flow with the most elements. May return nil if queue is empty.
+func (q *FairQueue) PopLargest() interface{} {
+	largest := -1
+
+	for i, key := range q.active {
+		if largest < 0 || len(q.flows[key].elems) > len(q.flows[q.active[largest]].elems) {
+			largest = i
+		}
+	}
+	if largest < 0 {
+		return nil
+	}
+	e, _ := q.remove(largest, true)
+	return e
+}
+
+// Returns the key of the flow with the most elements, and its length.
+func (q *FairQueue) Largest() (string, int) {
+	var key string
+	var l int
+
+	for _, k := range q.active {
+		if len(q.flows[k].elems) > l {
+			key, l = k, len(q.flows[k].elems)
+		}
+	}
+	return key, l
+}
+
+func (q *FairQueue) take(back bool) interface{} {
+	if q.l == 0 {
+		return nil
+	}
+	if q.next >= len(q.active) {
+		q.next = 0
+	}
+
+	i := q.next
+	e, emptied := q.remove(i, back)
+
+	// Otherwise, the following flow has moved to index i.
+	if !emptied {
+		q.next = i + 1
+	}
+	return e
+}
+
+// Remove the first or last element of the flow at active[i]. The flow is removed if it
+// becomes empty; then true is returned.
+func (q *FairQueue) remove(i int, back bool) (interface{}, bool) {
+	key := q.active[i]
+	f := q.flows[key]
+
+	var e interface{}
+	if back {
+		e = f.elems[len(f.elems)-1]
+		f.elems[len(f.elems)-1] = nil
+		f.elems = f.elems[:len(f.elems)-1]
+	} else {
+		e = f.elems[0]
+		f.elems[0] = nil
+		f.elems = f.elems[1:]
+	}
+	q.l--
+
+	if len(f.elems) > 0 {
+		return e, false
+	}
+
+	delete(q.flows, key)
+	q.active = append(q.active[:i], q.active[i+1:]...)
+
+	if i < q.next {
+		q.next--
+	}
+	return e, true
+}
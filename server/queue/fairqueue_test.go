@@ -0,0 +1,77 @@
+package queue
+
+import "testing"
+
+func TestFairQueueRoundRobin(t *testing.T) {
+	q := NewFairQueue()
+
+	for i := 0; i < 4; i++ {
+		q.Push("a", "a")
+	}
+	q.Push("b", "b")
+	q.Push("c", "c")
+
+	// b and c get their turn before a's backlog is served
+	expected := []string{"a", "b", "c", "a", "a", "a"}
+
+	for i, e := range expected {
+		if got := q.Pop(); got != e {
+			t.Fatal("Element", i, ": expected", e, "got", got)
+		}
+	}
+	if q.Len() != 0 || q.Pop() != nil {
+		t.Fatal("Queue not empty")
+	}
+}
+
+func TestFairQueueFIFOPerFlow(t *testing.T) {
+	q := NewFairQueue()
+
+	q.Push("a", 1)
+	q.Push("a", 2)
+	q.Push("a", 3)
+
+	if q.Pop() != 1 || q.PopBack() != 3 || q.Pop() != 2 {
+		t.Fatal("Wrong order within flow")
+	}
+}
+
+func TestFairQueueNewFlowJoinsRound(t *testing.T) {
+	q := NewFairQueue()
+
+	q.Push("a", "a1")
+	q.Push("a", "a2")
+	q.Push("b", "b1")
+
+	if q.Pop() != "a1" {
+		t.Fatal("Expected a1")
+	}
+	// c joins after b in the current round
+	q.Push("c", "c1")
+
+	expected := []string{"b1", "c1", "a2"}
+
+	for _, e := range expected {
+		if got := q.Pop(); got != e {
+			t.Fatal("Expected", e, "got", got)
+		}
+	}
+}
+
+func TestFairQueuePopLargest(t *testing.T) {
+	q := NewFairQueue()
+
+	q.Push("a", "a1")
+	q.Push("b", "b1")
+	q.Push("b", "b2")
+
+	if key, l := q.Largest(); key != "b" || l != 2 {
+		t.Fatal("Wrong largest flow:", key, l)
+	}
+	if q.PopLargest() != "b2" {
+		t.Fatal("Expected b2")
+	}
+	if q.FlowLen("b") != 1 || q.Len() != 2 {
+		t.Fatal("Wrong lengths")
+	}
+}
@@ -0,0 +1,107 @@
+package queue
+
+/*
+A MultiQueue is a priority queue with a fixed number of levels; elements of a higher level
+are always taken before those of lower levels. Within a level, elements are taken fairly
+from all flows (see FairQueue), and within a flow in FIFO order (or LIFO, using PopBack()).
+The capacity is shared by all levels.
+*/
+type MultiQueue struct {
+	levels   []FairQueue
+	l, limit int
+}
+
+func NewMultiQueue(levels, capacity int) MultiQueue {
+	q := MultiQueue{levels: make([]FairQueue, levels), limit: capacity}
+
+	for i := range q.levels {
+		q.levels[i] = NewFairQueue()
+	}
+	return q
+}
+
+// Number of elements on all levels.
+func (q *MultiQueue) Len() int {
+	return q.l
+}
+
+// Maximum number of elements on all levels.
+func (q *MultiQueue) Capacity() int {
+	return q.limit
+}
+
+// Change the capacity. Elements beyond a reduced capacity stay queued, but no new ones are
+// accepted until there is room again.
+func (q *MultiQueue) SetCapacity(capacity int) {
+	q.limit = capacity
+}
+
+// Number of elements on one level.
+func (q *MultiQueue) LevelLen(level int) int {
+	return q.levels[q.clamp(level)].Len()
+}
+
+// Append to the back of a flow on a level. Levels out of range are treated as the lowest or
+// highest one, respectively. Returns false if the queue is full.
+func (q *MultiQueue) Push(level int, key string, e interface{}) bool {
+	if q.l >= q.limit {
+		return false
+	}
+	q.levels[q.clamp(level)].Push(key, e)
+	q.l++
+	return true
+}
+
+// Get the next element of the highest non-empty level. May return nil if queue is empty.
+func (q *MultiQueue) Pop() interface{} {
+	for i := len(q.levels) - 1; i >= 0; i-- {
+		if q.levels[i].Len() > 0 {
+			q.l--
+			return q.levels[i].Pop()
+		}
+	}
+	return nil
+}
+
+// Like Pop(), but takes the newest element of the flow. May return nil if queue is empty.
+func (q *MultiQueue) PopBack() interface{} {
+	for i := len(q.levels) - 1; i >= 0; i-- {
+		if q.levels[i].Len() > 0 {
+			q.l--
+			return q.levels[i].PopBack()
+		}
+	}
+	return nil
+}
+
+/*
+Remove an element to make room for a new element of flow key on level: The newest element of
+the largest flow on the lowest non-empty level below level or, if there is none, of the
+largest flow on level, if it is larger than key's flow would be with the new element.
+Returns nil if no element qualifies.
+*/
+func (q *MultiQueue) Evict(level int, key string) interface{} {
+	level = q.clamp(level)
+
+	for i := 0; i < level; i++ {
+		if q.levels[i].Len() > 0 {
+			q.l--
+			return q.levels[i].PopLargest()
+		}
+	}
+
+	if _, l := q.levels[level].Largest(); l > q.levels[level].FlowLen(key)+1 {
+		q.l--
+		return q.levels[level].PopLargest()
+	}
+	return nil
+}
+
+func (q *MultiQueue) clamp(level int) int {
+	if level < 0 {
+		return 0
+	} else if level >= len(q.levels) {
+		return len(q.levels) - 1
+	}
+	return level
+}
@@ -0,0 +1,92 @@
+package queue
+
+import "testing"
+
+func TestMultiQueueOrder(t *testing.T) {
+	q := NewMultiQueue(3, 10)
+
+	q.Push(0, "", "low1")
+	q.Push(2, "", "high1")
+	q.Push(1, "", "mid1")
+	q.Push(2, "", "high2")
+	q.Push(0, "", "low2")
+
+	if q.Len() != 5 || q.LevelLen(2) != 2 {
+		t.Fatal("Wrong length:", q.Len(), q.LevelLen(2))
+	}
+
+	expected := []string{"high1", "high2", "mid1", "low1", "low2"}
+
+	for _, e := range expected {
+		if got := q.Pop(); got != e {
+			t.Fatal("Expected", e, "got", got)
+		}
+	}
+	if q.Pop() != nil || q.Len() != 0 {
+		t.Fatal("Queue not empty")
+	}
+}
+
+func TestMultiQueueLimit(t *testing.T) {
+	q := NewMultiQueue(2, 2)
+
+	if !q.Push(0, "", 1) || !q.Push(1, "", 2) {
+		t.Fatal("Could not push")
+	}
+	if q.Push(1, "", 3) {
+		t.Fatal("Could push into full queue")
+	}
+
+	// Out-of-range levels
+	q.Pop()
+	q.Pop()
+	q.Push(-1, "", "low")
+	q.Push(5, "", "high")
+
+	if q.Pop() != "high" || q.Pop() != "low" {
+		t.Fatal("Levels not clamped")
+	}
+}
+
+func TestMultiQueueEvict(t *testing.T) {
+	q := NewMultiQueue(3, 10)
+
+	q.Push(2, "a", "high")
+	q.Push(1, "a", "mid1")
+	q.Push(1, "a", "mid2")
+	q.Push(1, "b", "mid3")
+
+	if q.Evict(1, "a") != nil {
+		t.Fatal("Evicted element of same level for the largest flow")
+	}
+	if got := q.Evict(1, "c"); got != "mid2" {
+		t.Fatal("Expected newest element of largest flow, got", got)
+	}
+	if got := q.Evict(2, "c"); got != "mid1" && got != "mid3" {
+		t.Fatal("Expected lower-level element, got", got)
+	}
+	if got := q.PopBack(); got != "high" {
+		t.Fatal("Expected high, got", got)
+	}
+	if q.Len() != 1 {
+		t.Fatal("Wrong length", q.Len())
+	}
+}
+
+func TestMultiQueueSetCapacity(t *testing.T) {
+	q := NewMultiQueue(2, 2)
+
+	q.Push(0, "", 1)
+	q.Push(0, "", 2)
+	q.SetCapacity(1)
+
+	if q.Push(1, "", 3) || q.Len() != 2 {
+		t.Fatal("Could push beyond reduced capacity")
+	}
+
+	q.SetCapacity(3)
+
+	if !q.Push(1, "", 3) || q.Capacity() != 3 {
+		t.Fatal("Could not push after increasing capacity")
+	}
+}
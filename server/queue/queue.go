@@ -43,6 +43,33 @@ func (q *Queue) Pop() interface{} {
 	}
 }
 
+// Get from the back, i.e. the most recently pushed element. May return nil if queue is empty.
+func (q *Queue) PopBack() interface{} {
+	if q.Len() > 0 {
+		q.back = (q.back - 1 + len(q.queue)) % len(q.queue)
+		e := q.queue[q.back]
+		q.queue[q.back] = nil
+		q.l--
+		return e
+	} else {
+		return nil
+	}
+}
+
+// Make room for at least n elements. Elements keep their order.
+func (q *Queue) Grow(n int) {
+	if n <= len(q.queue) {
+		return
+	}
+
+	queue := make([]interface{}, n)
+	for i := 0; i < q.l; i++ {
+		queue[i] = q.queue[(q.front+i)%len(q.queue)]
+	}
+	q.queue = queue
+	q.front, q.back = 0, q.l%n
+}
+
 // Returns the front element without removing it.
 func (q *Queue) peek() interface{} {
 	if q.Len() > 0 {
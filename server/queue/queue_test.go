@@ -83,6 +83,36 @@ func TestPeek(t *testing.T) {
 	}
 }
 
+func TestPopBack(t *testing.T) {
+	q := NewQueue(3)
+
+	// Wrap around
+	q.Push(1)
+	q.Pop()
+	q.Push(2)
+	q.Push(3)
+	q.Push(4)
+
+	if 4 != q.PopBack().(int) {
+		t.Fatal("Wrong element from back")
+	}
+	if 2 != q.Pop().(int) {
+		t.Fatal("Wrong element from front")
+	}
+	if 3 != q.PopBack().(int) {
+		t.Fatal("Wrong last element")
+	}
+	if q.PopBack() != nil || q.Len() != 0 {
+		t.Fatal("Queue not empty")
+	}
+
+	q.Push(5)
+
+	if 5 != q.Pop().(int) {
+		t.Fatal("Wrong element after PopBack()")
+	}
+}
+
 // Benches time for Pushing, then Popping 10 elements from a long queue
 func BenchmarkQueue(b *testing.B) {
 	q := NewQueue(1000)
@@ -134,3 +164,26 @@ func BenchmarkQueueChan(b *testing.B) {
 		}
 	}
 }
+
+func TestGrow(t *testing.T) {
+	q := NewQueue(3)
+
+	// Wrap around
+	q.Push(1)
+	q.Pop()
+	q.Push(2)
+	q.Push(3)
+	q.Push(4)
+
+	q.Grow(5)
+
+	if !q.Push(5) || !q.Push(6) || q.Push(7) {
+		t.Fatal("Wrong capacity after growing")
+	}
+
+	for i := 2; i <= 6; i++ {
+		if e := q.Pop().(int); e != i {
+			t.Fatal("Wrong element:", e, "expected", i)
+		}
+	}
+}
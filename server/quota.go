@@ -0,0 +1,169 @@
+package server
+
+import (
+	"github.com/dermesser/clusterrpc/proto"
+	"time"
+)
+
+// Metadata property of messages on CURVE-secured sockets that has the client's public key (set
+// by the ZAP handler of securitymanager).
+const ZAP_USER_ID string = "User-Id"
+
+/*
+Limits for the requests of one caller. Requests exceeding a quota are refused with
+STATUS_QUOTA_EXCEEDED. Zero values mean no limit.
+
+If the server uses CURVE security (see securitymanager), callers are identified by their
+Z85-encoded public key, which can't be forged. Otherwise, they are identified by the caller
+ID they send (see client.New()). The same applies to fair queuing.
+*/
+type Quota struct {
+	// Requests per second admitted on average, and how many may be admitted at once (at least 1)
+	Rate  float64
+	Burst int
+	// Requests of the caller that may be queued or in progress at the same time
+	MaxConcurrent int
+}
+
+func (q Quota) limited() bool {
+	return q.Rate > 0 || q.MaxConcurrent > 0
+}
+
+// Set the quota for callers without a quota of their own (see SetQuota()). Default: no limits
+func (srv *Server) SetDefaultQuota(q Quota) {
+	srv.quota_lock.Lock()
+	defer srv.quota_lock.Unlock()
+
+	srv.default_quota = q
+}
+
+// Set the quota of one caller (a public key or caller ID, see Quota), overriding the default quota.
+func (srv *Server) SetQuota(caller_id string, q Quota) {
+	srv.quota_lock.Lock()
+	defer srv.quota_lock.Unlock()
+
+	srv.quotas[caller_id] = q
+}
+
+// Remove the quota of one caller; the default quota applies again.
+func (srv *Server) RemoveQuota(caller_id string) {
+	srv.quota_lock.Lock()
+	defer srv.quota_lock.Unlock()
+
+	delete(srv.quotas, caller_id)
+}
+
+// Returns the key identifying the caller of request: user_id (see ZAP_USER_ID) if set, or else the caller ID.
+func callerKey(request *proto.RPCRequest, user_id string) string {
+	if user_id != "" {
+		return user_id
+	}
+	return request.GetCallerId()
+}
+
+func (srv *Server) quotaFor(caller_id string) Quota {
+	srv.quota_lock.RLock()
+	defer srv.quota_lock.RUnlock()
+
+	if q, ok := srv.quotas[caller_id]; ok {
+		return q
+	}
+	return srv.default_quota
+}
+
+// Usage of a caller with a quota, tracked by the load balancer.
+type callerState struct {
+	// Token bucket for the rate limit
+	tokens      float64
+	last_refill time.Time
+	in_flight   int
+}
+
+func burstSize(q Quota) float64 {
+	if q.Burst < 1 {
+		return 1
+	}
+	return float64(q.Burst)
+}
+
+func (c *callerState) refill(q Quota, now time.Time) {
+	burst := burstSize(q)
+
+	c.tokens += now.Sub(c.last_refill).Seconds() * q.Rate
+	if c.tokens > burst {
+		c.tokens = burst
+	}
+	c.last_refill = now
+}
+
+/*
+Check a new request against its caller's quota. If it is admitted, it counts towards the
+caller's concurrency quota until release() is called for it.
+*/
+func (srv *Server) admit(lb *balancer, rq *lbRequest) bool {
+	caller := rq.caller
+	q := srv.quotaFor(caller)
+
+	if !q.limited() {
+		return true
+	}
+
+	now := time.Now()
+	c, ok := lb.callers[caller]
+
+	if !ok {
+		c = &callerState{last_refill: now}
+		c.tokens = burstSize(q)
+		lb.callers[caller] = c
+	}
+
+	if q.MaxConcurrent > 0 && c.in_flight >= q.MaxConcurrent {
+		return false
+	}
+
+	if q.Rate > 0 {
+		c.refill(q, now)
+
+		if c.tokens < 1 {
+			return false
+		}
+		c.tokens--
+	}
+
+	c.in_flight++
+	rq.counted = true
+	return true
+}
+
+// A request admitted by admit() is finished (or refused after all).
+func (lb *balancer) release(caller string) {
+	if c, ok := lb.callers[caller]; ok && c.in_flight > 0 {
+		c.in_flight--
+	}
+}
+
+// A worker has finished its request.
+func (lb *balancer) releaseWorker(worker_id []byte) {
+	if caller, ok := lb.worker_callers[string(worker_id)]; ok {
+		delete(lb.worker_callers, string(worker_id))
+		lb.release(caller)
+	}
+}
+
+// Forget callers without requests in flight whose token bucket is full again.
+func (srv *Server) expireCallers(lb *balancer) {
+	now := time.Now()
+
+	for caller, c := range lb.callers {
+		if c.in_flight > 0 {
+			continue
+		}
+
+		q := srv.quotaFor(caller)
+		c.refill(q, now)
+
+		if q.Rate <= 0 || c.tokens >= burstSize(q) {
+			delete(lb.callers, caller)
+		}
+	}
+}
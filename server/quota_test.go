@@ -0,0 +1,49 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func TestCallerKeyPrefersAuthenticatedUser(t *testing.T) {
+	request := &proto.RPCRequest{CallerId: pb.String("claimed")}
+
+	if key := callerKey(request, ""); key != "claimed" {
+		t.Error("unexpected key without User-Id:", key)
+	}
+	if key := callerKey(request, "public-key"); key != "public-key" {
+		t.Error("unexpected key with User-Id:", key)
+	}
+}
+
+func TestQuotaKeyedByCaller(t *testing.T) {
+	srv := &Server{quotas: make(map[string]Quota)}
+	srv.SetQuota("public-key", Quota{MaxConcurrent: 1})
+	lb := &balancer{callers: make(map[string]*callerState)}
+
+	// All requests claim the caller ID of the caller with the quota, but one is authenticated
+	// with another key.
+	request := &proto.RPCRequest{CallerId: pb.String("public-key")}
+	claimed := &lbRequest{request: request, caller: callerKey(request, "other-key")}
+	authenticated := &lbRequest{request: request, caller: callerKey(request, "public-key")}
+	second := &lbRequest{request: request, caller: callerKey(request, "public-key")}
+
+	if !srv.admit(lb, authenticated) || !authenticated.counted {
+		t.Fatal("first request of the caller refused")
+	}
+	if srv.admit(lb, second) {
+		t.Fatal("request beyond the quota admitted")
+	}
+	if !srv.admit(lb, claimed) || claimed.counted {
+		t.Fatal("request of another caller counted against the quota")
+	}
+
+	lb.release(authenticated.caller)
+
+	if !srv.admit(lb, second) {
+		t.Fatal("request refused after release")
+	}
+}
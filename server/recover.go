@@ -0,0 +1,78 @@
+package server
+
+/*
+* Recovering from panics in handlers: A panic is logged and answered with STATUS_SERVER_ERROR,
+* so that the worker's socket stays usable and the process keeps running.
+ */
+
+import (
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Describes a panic in a handler (see SetPanicHandler()).
+type PanicInfo struct {
+	Service, Endpoint string
+	RpcId, CallerId   string
+	// The value passed to panic()
+	Value interface{}
+	// Stack trace of the panicking goroutine
+	Stack []byte
+}
+
+/*
+Set a function that is called when a handler panics, e.g. for reporting the panic to an
+error tracker. It is called by the worker, after the panic has been logged and before the
+error response is sent. nil removes the panic handler.
+*/
+func (srv *Server) SetPanicHandler(f func(PanicInfo)) {
+	srv.panic_handler.Store(f)
+}
+
+// Don't recover panics in handlers, but let them crash the process (e.g. for tests). The panic
+// handler is still called.
+func (srv *Server) SetCrashOnPanic(crash bool) {
+	if crash {
+		atomic.StoreUint32(&srv.crash_on_panic, 1)
+	} else {
+		atomic.StoreUint32(&srv.crash_on_panic, 0)
+	}
+}
+
+// Invoke the handler of ep. Returns false if it panicked.
+func (srv *Server) callHandler(ep *registeredEndpoint, cx *Context, stream *ServerStream) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			ok = false
+			srv.handlePanic(cx, v, debug.Stack())
+		}
+	}()
+
+	if ep.stream_handler == nil {
+		ep.handler(cx)
+	} else if stream == nil {
+		cx.Fail("Streaming endpoint; the request must be sent as stream")
+	} else {
+		ep.stream_handler(cx, stream)
+	}
+	return true
+}
+
+func (srv *Server) handlePanic(cx *Context, v interface{}, stack []byte) {
+	info := PanicInfo{Service: cx.orig_rq.GetSrvc(), Endpoint: cx.orig_rq.GetProcedure(),
+		RpcId: cx.orig_rq.GetRpcId(), CallerId: cx.orig_rq.GetCallerId(), Value: v, Stack: stack}
+
+	log.CRPC_log(log.LOGLEVEL_ERRORS, fmt.Sprintf("[_/%s/%s] Handler %s.%s panicked: %v\n%s",
+		info.CallerId, info.RpcId, info.Service, info.Endpoint, v, stack))
+
+	atomic.AddUint64(&srv.stats.panics, 1)
+
+	if f, _ := srv.panic_handler.Load().(func(PanicInfo)); f != nil {
+		f(info)
+	}
+	if atomic.LoadUint32(&srv.crash_on_panic) == 1 {
+		panic(v)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func newPanicTestContext(srv *Server) *Context {
+	return srv.newContext(&proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Panic"),
+		RpcId: pb.String("rpc1"), CallerId: pb.String("caller1")}, nil)
+}
+
+func panickingEndpoint() *registeredEndpoint {
+	return &registeredEndpoint{handler: func(cx *Context) {
+		panic("handler failed")
+	}}
+}
+
+func TestRecoverHandlerPanic(t *testing.T) {
+	srv := &Server{}
+	var info *PanicInfo
+
+	srv.SetPanicHandler(func(i PanicInfo) {
+		info = &i
+	})
+
+	if srv.callHandler(panickingEndpoint(), newPanicTestContext(srv), nil) {
+		t.Fatal("panic not reported")
+	}
+	if info == nil {
+		t.Fatal("panic handler not called")
+	}
+	if info.Service != "Test" || info.Endpoint != "Panic" || info.RpcId != "rpc1" || info.CallerId != "caller1" ||
+		info.Value != "handler failed" {
+		t.Error("unexpected PanicInfo:", info)
+	}
+	if !bytes.Contains(info.Stack, []byte("panickingEndpoint")) {
+		t.Error("stack doesn't show the handler:", string(info.Stack))
+	}
+	if srv.stats.panics != 1 {
+		t.Error("panic not counted:", srv.stats.panics)
+	}
+
+	srv.SetPanicHandler(nil)
+
+	if srv.callHandler(panickingEndpoint(), newPanicTestContext(srv), nil) || srv.stats.panics != 2 {
+		t.Error("panic without panic handler not recovered")
+	}
+}
+
+func TestCrashOnPanic(t *testing.T) {
+	srv := &Server{}
+	srv.SetCrashOnPanic(true)
+
+	defer func() {
+		if v := recover(); v != "handler failed" {
+			t.Error("unexpected panic:", v)
+		}
+	}()
+
+	srv.callHandler(panickingEndpoint(), newPanicTestContext(srv), nil)
+	t.Error("handler panic recovered")
+}
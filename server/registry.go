@@ -0,0 +1,144 @@
+package server
+
+/*
+* The registry of services and endpoints is copy-on-write: Workers and the load balancer read
+* the current version without locking, while changes are made to a copy that replaces the
+* current version atomically. Published versions, including their services, are never modified.
+ */
+
+import (
+	"errors"
+	"github.com/dermesser/clusterrpc/log"
+)
+
+// Services by name. Immutable once stored in Server.registry.
+type registry map[string]*service
+
+// Returns the current version of the registry.
+func (srv *Server) services() registry {
+	return srv.registry.Load().(registry)
+}
+
+// Apply f to a copy of the registry and publish the copy, unless f returns an error.
+func (srv *Server) updateRegistry(f func(r registry) error) error {
+	srv.registry_lock.Lock()
+	defer srv.registry_lock.Unlock()
+
+	current := srv.services()
+	r := make(registry, len(current)+1)
+
+	for name, svc := range current {
+		r[name] = svc
+	}
+
+	if err := f(r); err != nil {
+		return err
+	}
+	srv.registry.Store(r)
+	return nil
+}
+
+func newService() *service {
+	return &service{endpoints: make(map[string]*registeredEndpoint)}
+}
+
+/*
+The built-in service (BUILTIN_SERVICE) with health checks and pings. Its handlers are called
+directly by the load balancer, so it can't be changed by users.
+*/
+func newBuiltinService(srv *Server) *service {
+	svc := newService()
+	svc.endpoints["Health"] = &registeredEndpoint{handler: makeHealthHandler(srv.isLameduck)}
+	svc.endpoints["Ping"] = &registeredEndpoint{handler: pingHandler}
+	return svc
+}
+
+// Returns a copy of svc that can be modified.
+func (svc *service) clone() *service {
+	c := *svc
+	c.endpoints = make(map[string]*registeredEndpoint, len(svc.endpoints)+1)
+
+	for name, ep := range svc.endpoints {
+		c.endpoints[name] = ep
+	}
+	return &c
+}
+
+// Add an endpoint to an unpublished service.
+func (svc *service) add(name string, ep *registeredEndpoint, opts []HandlerOption) error {
+	if _, ok := svc.endpoints[name]; ok {
+		return errors.New("Endpoint already registered; not overwritten")
+	}
+
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ep.limit = concurrencyLimit{max_concurrent: o.max_concurrent, reject_excess: o.reject_excess}
+	if o.service_max_concurrent > 0 {
+		svc.limit = concurrencyLimit{max_concurrent: o.service_max_concurrent, reject_excess: o.reject_excess}
+	}
+	ep.timeout = o.timeout
+	if o.service_timeout > 0 {
+		svc.timeout = o.service_timeout
+	}
+
+	svc.endpoints[name] = ep
+	return nil
+}
+
+/*
+A set of endpoints that replaces all endpoints of a service at once (see SwapService()), e.g.
+for enabling a plugin at runtime. Endpoints are added like to a Server.
+*/
+type EndpointSet struct {
+	svc *service
+}
+
+func NewEndpointSet() *EndpointSet {
+	return &EndpointSet{svc: newService()}
+}
+
+// Add an endpoint like Server.RegisterHandler().
+func (s *EndpointSet) RegisterHandler(endpoint string, handler Handler, opts ...HandlerOption) error {
+	return s.svc.add(endpoint, &registeredEndpoint{handler: handler}, opts)
+}
+
+// Add an endpoint like Server.RegisterStreamingHandler().
+func (s *EndpointSet) RegisterStreamingHandler(endpoint string, handler StreamHandler, opts ...HandlerOption) error {
+	return s.svc.add(endpoint, &registeredEndpoint{stream_handler: handler, sends: true}, opts)
+}
+
+// Add an endpoint like Server.RegisterClientStreamingHandler().
+func (s *EndpointSet) RegisterClientStreamingHandler(endpoint string, handler StreamHandler, opts ...HandlerOption) error {
+	return s.svc.add(endpoint, &registeredEndpoint{stream_handler: handler, receives: true}, opts)
+}
+
+// Add an endpoint like Server.RegisterBidiStreamingHandler().
+func (s *EndpointSet) RegisterBidiStreamingHandler(endpoint string, handler StreamHandler, opts ...HandlerOption) error {
+	return s.svc.add(endpoint, &registeredEndpoint{stream_handler: handler, sends: true, receives: true}, opts)
+}
+
+/*
+Replace all endpoints of service svc by those in set, atomically: Every request is handled
+either by the old or by the new set of endpoints. A nil or empty set removes the service.
+Requests being handled keep running with the old handlers. Endpoints added to the set
+afterwards are not served.
+*/
+func (srv *Server) SwapService(svc string, set *EndpointSet) error {
+	if svc == BUILTIN_SERVICE {
+		return errors.New("The built-in service can't be replaced")
+	}
+
+	return srv.updateRegistry(func(r registry) error {
+		if set == nil || len(set.svc.endpoints) == 0 {
+			delete(r, svc)
+			log.CRPC_log(log.LOGLEVEL_INFO, "Removed service:", svc)
+		} else {
+			r[svc] = set.svc.clone()
+			log.CRPC_log(log.LOGLEVEL_INFO, "Replaced endpoints of service:", svc)
+		}
+		return nil
+	})
+}
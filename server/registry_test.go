@@ -0,0 +1,90 @@
+package server
+
+import "testing"
+
+func newRegistryTestServer() *Server {
+	srv := &Server{}
+	srv.registry.Store(registry{BUILTIN_SERVICE: newBuiltinService(srv)})
+	return srv
+}
+
+func nopHandler(cx *Context) {}
+
+func TestRegistryCopyOnWrite(t *testing.T) {
+	srv := newRegistryTestServer()
+
+	if err := srv.RegisterHandler("Test", "A", nopHandler); err != nil {
+		t.Fatal(err)
+	}
+	if srv.RegisterHandler("Test", "A", nopHandler) == nil {
+		t.Fatal("endpoint registered twice")
+	}
+
+	before := srv.services()
+
+	if err := srv.RegisterHandler("Test", "B", nopHandler); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := before["Test"].endpoints["B"]; ok {
+		t.Fatal("published registry modified")
+	}
+	if srv.findHandler("Test", "B") == nil {
+		t.Fatal("new endpoint not found")
+	}
+
+	if err := srv.UnregisterHandler("Test", "A"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.findHandler("Test", "A") != nil || before["Test"].endpoints["A"] == nil {
+		t.Fatal("unregistering not copy-on-write")
+	}
+	if srv.UnregisterHandler("Test", "A") == nil {
+		t.Fatal("unregistered endpoint twice")
+	}
+}
+
+func TestSwapService(t *testing.T) {
+	srv := newRegistryTestServer()
+	srv.RegisterHandler("Test", "Old", nopHandler)
+
+	set := NewEndpointSet()
+	set.RegisterHandler("New", nopHandler)
+
+	if err := srv.SwapService("Test", set); err != nil {
+		t.Fatal(err)
+	}
+	if srv.findHandler("Test", "Old") != nil || srv.findHandler("Test", "New") == nil {
+		t.Fatal("endpoints not swapped")
+	}
+
+	// The set is copied; later changes don't affect the server.
+	set.RegisterHandler("Later", nopHandler)
+
+	if srv.findHandler("Test", "Later") != nil {
+		t.Fatal("endpoint added to the set after swapping is served")
+	}
+
+	if err := srv.SwapService("Test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.services()["Test"]; ok {
+		t.Fatal("service not removed")
+	}
+}
+
+func TestBuiltinServiceCantBeChanged(t *testing.T) {
+	srv := newRegistryTestServer()
+
+	if srv.RegisterHandler(BUILTIN_SERVICE, "Custom", nopHandler) == nil {
+		t.Error("endpoint added to the built-in service")
+	}
+	if srv.UnregisterHandler(BUILTIN_SERVICE, "Health") == nil {
+		t.Error("health check removed")
+	}
+	if srv.SwapService(BUILTIN_SERVICE, NewEndpointSet()) == nil {
+		t.Error("built-in service replaced")
+	}
+	if srv.findHandler(BUILTIN_SERVICE, "Health") == nil || srv.findHandler(BUILTIN_SERVICE, "Ping") == nil {
+		t.Error("built-in endpoints missing")
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"github.com/dermesser/clusterrpc/proto"
+	"sync"
+	"time"
+)
+
+// How many sampled RPCs are kept for inspection.
+const SAMPLED_RPCS_KEPT int = 100
+
+// A SampledRPC describes a recently handled RPC, as shown on the admin server.
+type SampledRPC struct {
+	Time     time.Time
+	Endpoint string
+	CallerId string
+	RpcId    string
+	Status   proto.RPCResponse_Status
+	Duration time.Duration
+	// May be nil if the RPC was not traced
+	Trace *proto.TraceInfo
+}
+
+// Keeps every n-th RPC in a ring buffer.
+type rpcSampler struct {
+	mx sync.Mutex
+	// 0 = sampling disabled
+	one_in  uint
+	counter uint
+
+	ring []SampledRPC
+	next int
+}
+
+// Decides whether the next RPC should be sampled.
+func (s *rpcSampler) sample() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.one_in == 0 {
+		return false
+	}
+	s.counter++
+	return s.counter%s.one_in == 0
+}
+
+func (s *rpcSampler) record(rpc SampledRPC) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if len(s.ring) < SAMPLED_RPCS_KEPT {
+		s.ring = append(s.ring, rpc)
+	} else {
+		s.ring[s.next] = rpc
+	}
+	s.next = (s.next + 1) % SAMPLED_RPCS_KEPT
+}
+
+// Returns the sampled RPCs, most recent first.
+func (s *rpcSampler) recent() []SampledRPC {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	rpcs := make([]SampledRPC, 0, len(s.ring))
+	for i := 1; i <= len(s.ring); i++ {
+		rpcs = append(rpcs, s.ring[(s.next-i+len(s.ring))%len(s.ring)])
+	}
+	return rpcs
+}
+
+/*
+Sample every n-th RPC handled by this server, so that it is shown on the admin server
+(with a trace of the call tree below it). n == 0 disables sampling, which is the default.
+*/
+func (srv *Server) SetSampleRate(n uint) {
+	srv.sampler.mx.Lock()
+	defer srv.sampler.mx.Unlock()
+
+	srv.sampler.one_in = n
+}
+
+// Returns the most recently sampled RPCs, most recent first.
+func (srv *Server) GetSampledRPCs() []SampledRPC {
+	return srv.sampler.recent()
+}
@@ -3,10 +3,14 @@ package server
 import (
 	"errors"
 	"fmt"
+	"github.com/dermesser/clusterrpc/compression"
 	"github.com/dermesser/clusterrpc/log"
 	smgr "github.com/dermesser/clusterrpc/securitymanager"
+	"github.com/dermesser/clusterrpc/server/queue"
 	golog "log"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	zmq "github.com/pebbe/zmq4"
@@ -16,20 +20,74 @@ import (
 Handles incoming requests and registering of handler functions.
 */
 type Server struct {
+	// Accessed atomically; 64-bit values come first for alignment on 32-bit platforms.
+	stats        serverStats
+	codel_target int64
+
 	// Router receives new requests, dealer distributes them between the threads
 	frontend_router, backend_router *zmq.Socket
-	services                        map[string]*service
+	bindurls                        []boundEndpoint
+	bindurls_lock                   sync.Mutex
+	// inproc endpoints of the backend router and the command socket, unique per server
+	backend_path, command_path string
+	// Current registry (see registry.go); registry_lock serializes changes
+	registry      atomic.Value
+	registry_lock sync.Mutex
 	// The timeout only applies on client connections (R/W), not the Listener
 	timeout      time.Duration
 	workers      uint
 	machine_name string
-	// Respond "no" to healthchecks
-	lameduck_state bool
-	// Do not accept requests anymore
-	loadshed_state bool
+	// Responses of at least this size are compressed, if the client accepts compression
+	compression_threshold int
+	// Serve the newest queued request first when more than this many are queued; 0 = always FIFO
+	lifo_threshold int
+	// Target queueing delay for overload control (0 = disabled; see codel_target) and its interval;
+	// codel_target is accessed atomically, as it may be changed while the server is running
+	codel_interval time.Duration
+	// See SetPanicHandler() and SetCrashOnPanic(); both may be changed while workers run, so
+	// panic_handler (a func(PanicInfo)) and crash_on_panic (1 = true) are accessed atomically
+	panic_handler  atomic.Value
+	crash_on_panic uint32
+
+	// Per-caller quotas; read by the load balancer
+	quota_lock    sync.RWMutex
+	default_quota Quota
+	quotas        map[string]Quota
+	// Respond "no" to healthchecks (1 = true); accessed atomically
+	lameduck_state uint32
+	// Do not accept requests anymore (1 = true); accessed atomically
+	loadshed_state uint32
+
+	// Lifecycle (see lifecycle.go); state is accessed atomically, changed with state_lock held
+	state           int32
+	state_lock      sync.Mutex
+	state_callbacks []StateCallback
+	exit_err        error
+	done_once       sync.Once
+	stop_once       sync.Once
 
 	lblock    sync.Mutex
 	rpclogger *golog.Logger
+
+	// Commands for the load balancer (see sendCommand()); command_lock protects command_push
+	// and commands_closed, which is set when the server is closed.
+	commands                   chan lbCommand
+	command_pull, command_push *zmq.Socket
+	command_lock               sync.Mutex
+	commands_closed            bool
+	// Closed when the load balancer has stopped
+	done chan struct{}
+
+	// Contexts of running handlers, for canceling them on shutdown
+	contexts      map[*Context]bool
+	contexts_lock sync.Mutex
+	close_once    sync.Once
+
+	sampler rpcSampler
+	admin   *http.Server
+
+	security_manager *smgr.ServerSecurityManager
+	publishers       []*Publisher
 }
 
 // A function that is called when the corresponding endpoint is requested. Note that it
@@ -37,14 +95,33 @@ type Server struct {
 // server.method) wherein server is an object with associated function method().
 type Handler (func(*Context))
 
+// A function that is called for a streaming endpoint. It sends and/or receives any number of
+// messages through stream and then returns; the final status is set on the Context as usual.
+type StreamHandler (func(*Context, *ServerStream))
+
+type registeredEndpoint struct {
+	// Exactly one of both is set
+	handler        Handler
+	stream_handler StreamHandler
+	// For streaming endpoints: whether the handler sends and/or receives stream messages
+	sends, receives bool
+	limit           concurrencyLimit
+	// Maximum runtime of the handler; 0 = unlimited
+	timeout time.Duration
+}
+
 type service struct {
-	endpoints map[string]Handler
+	endpoints map[string]*registeredEndpoint
+	limit     concurrencyLimit
+	// Maximum runtime of handlers without a timeout of their own
+	timeout time.Duration
 }
 
 /*
 Create server listening on the specified laddr:port. laddr has to be "*" or an IP address, names
-do not work. There is usually only one server listening per process
-(though it is possible to use multiple servers on different ports, of course)
+do not work. Use NewMultiServer() for listening on several addresses. Several servers may listen
+on different ports in one process, e.g. a public API and an internal admin port, each with a
+security manager of its own.
 
 worker_threads is the number of workers; however, there are (additionally) at least one load-balancing thread
 and one ZeroMQ networking thread.
@@ -53,35 +130,41 @@ security_manager adds CURVE and IP "authentication" security to the server. If i
 not add security.
 
 Use the setter functions described below before calling Start(), otherwise they might
-be ignored.
-
+be ignored. Socket settings are passed as opts (see ServerOptions).
 */
-func NewServer(host string, port uint, threads uint, security_manager *smgr.ServerSecurityManager) (*Server, error) {
-	return newServer([]string{fmt.Sprintf("tcp://%s:%d", host, port)},
+func NewServer(host string, port uint, threads uint, security_manager *smgr.ServerSecurityManager, opts ...ServerOption) (*Server, error) {
+	return newServer([]string{TCPEndpoint(host, port)},
 		threads,
-		security_manager)
+		security_manager,
+		makeServerOptions(opts))
 }
 
-func NewIPCServer(path string, threads uint, security_manager *smgr.ServerSecurityManager) (*Server, error) {
-	return newServer([]string{fmt.Sprintf("ipc://%s", path)}, threads, security_manager)
+func NewIPCServer(path string, threads uint, security_manager *smgr.ServerSecurityManager, opts ...ServerOption) (*Server, error) {
+	return newServer([]string{IPCEndpoint(path)}, threads, security_manager, makeServerOptions(opts))
 }
 
-func newServer(bindurls []string, worker_threads uint, security_manager *smgr.ServerSecurityManager) (*Server, error) {
+func newServer(bindurls []string, worker_threads uint, security_manager *smgr.ServerSecurityManager, options ServerOptions) (*Server, error) {
 	srv := new(Server)
-	srv.services = make(map[string]*service)
-	srv.timeout = time.Second * 3
+	srv.registry.Store(registry{BUILTIN_SERVICE: newBuiltinService(srv)})
+	srv.quotas = make(map[string]Quota)
+	srv.contexts = make(map[*Context]bool)
+
+	instance := atomic.AddUint64(&server_instances, 1)
+	srv.backend_path = fmt.Sprintf("%s_%d", BACKEND_ROUTER_PATH, instance)
+	srv.command_path = fmt.Sprintf("%s_%d", COMMAND_PATH, instance)
+	srv.security_manager = security_manager
+	srv.timeout = options.Timeout
+	srv.compression_threshold = compression.DEFAULT_THRESHOLD
 
 	if worker_threads <= 0 {
 		worker_threads = 1
 	}
 
 	srv.workers = worker_threads
-
-	srv.RegisterHandler("__CLUSTERRPC", "Health", makeHealthHandler(&srv.lameduck_state))
-	srv.RegisterHandler("__CLUSTERRPC", "Ping", pingHandler)
+	srv.stats.workers = int64(worker_threads)
+	srv.done = make(chan struct{})
 
 	var err error
-	zmq.SetIpv6(true)
 
 	srv.frontend_router, err = zmq.NewSocket(zmq.ROUTER)
 
@@ -91,8 +174,14 @@ func newServer(bindurls []string, worker_threads uint, security_manager *smgr.Se
 	}
 
 	srv.frontend_router.SetRouterMandatory(1)
-	srv.frontend_router.SetSndtimeo(srv.timeout)
-	srv.frontend_router.SetRcvtimeo(srv.timeout)
+
+	err = options.apply(srv.frontend_router)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when applying socket options:", err.Error())
+		srv.frontend_router.Close()
+		return nil, err
+	}
 
 	err = security_manager.ApplyToServerSocket(srv.frontend_router)
 
@@ -102,10 +191,8 @@ func newServer(bindurls []string, worker_threads uint, security_manager *smgr.Se
 	}
 
 	for _, bindurl := range bindurls {
-		log.CRPC_log(log.LOGLEVEL_INFO, "Binding frontend to ", bindurl)
-		err = srv.frontend_router.Bind(bindurl)
+		err = srv.bindFrontend(bindurl)
 		if err != nil {
-			log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when binding Router socket:", err.Error())
 			srv.frontend_router.Close()
 			return nil, err
 		}
@@ -120,7 +207,7 @@ func newServer(bindurls []string, worker_threads uint, security_manager *smgr.Se
 		return nil, err
 	}
 
-	err = srv.backend_router.Bind(BACKEND_ROUTER_PATH)
+	err = srv.backend_router.Bind(srv.backend_path)
 
 	if err != nil {
 		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when binding backend router socket:", err.Error())
@@ -130,54 +217,78 @@ func newServer(bindurls []string, worker_threads uint, security_manager *smgr.Se
 	}
 
 	srv.backend_router.SetRouterMandatory(1)
-	srv.backend_router.SetRcvtimeo(srv.timeout)
-	srv.backend_router.SetSndtimeo(srv.timeout)
+	srv.backend_router.SetRcvtimeo(zmqTimeout(srv.timeout))
+	srv.backend_router.SetSndtimeo(zmqTimeout(srv.timeout))
+
+	err = srv.setupCommands()
 
-	go srv.loadbalance()
+	if err != nil {
+		srv.frontend_router.Close()
+		srv.backend_router.Close()
+		return nil, err
+	}
 
 	return srv, nil
 }
 
 /*
 Starts worker threads. Returns an error if any thread couldn't set up its socket,
-otherwise it blocks until the server is stopped. The error is logged at any LOGLEVEL.
+otherwise it blocks until the server is stopped (see Stop() and Shutdown()). The error is
+logged at any LOGLEVEL.
+
+This is Serve() followed by Wait().
 */
 func (srv *Server) Start() error {
-
-	var i uint
-	for i = 0; i < srv.workers-1; i++ {
-		err := srv.thread(i, true)
-
-		if err != nil {
-			return err
-		}
+	if err := srv.Serve(); err != nil {
+		return err
 	}
-	return srv.thread(srv.workers-1, false)
+	return srv.Wait()
 }
 
-// Connect to loadbalancer thread and send special stop message.
-// Does not close sockets etc.
+// Connect to loadbalancer thread and send special stop message. Queued requests are dropped;
+// use Shutdown() to let them finish. Does not close sockets etc.
 func (srv *Server) Stop() error {
+	if srv.transition(STATE_STOPPED, STATE_CREATED) {
+		// Never served
+		srv.stopped()
+		return nil
+	}
 	return srv.stop()
 }
 
-// Close internal sockets. The server may not be used after calling Close().
+// Close internal sockets, attached publishers and the admin server, if running. The server may not be used after calling Close().
+// Calling Close() more than once has no effect.
 func (srv *Server) Close() {
-	srv.frontend_router.Close()
-	srv.backend_router.Close()
+	srv.close_once.Do(func() {
+		if srv.admin != nil {
+			srv.admin.Close()
+		}
+		for _, p := range srv.publishers {
+			p.Close()
+		}
+		// No command may be sent while or after closing the socket.
+		srv.command_lock.Lock()
+		srv.commands_closed = true
+		srv.command_push.Close()
+		srv.command_lock.Unlock()
+
+		srv.frontend_router.Close()
+		srv.backend_router.Close()
+		srv.command_pull.Close()
+	})
 }
 
 /*
 Set timeout for the routers used by the loadbalancer (the worker sockets don't really need a timeout
-because they're communicating via inproc://)
+because they're communicating via inproc://). 0 means no timeout.
 */
 func (srv *Server) SetTimeout(d time.Duration) {
 	srv.timeout = d
 
-	srv.backend_router.SetRcvtimeo(srv.timeout)
-	srv.backend_router.SetSndtimeo(srv.timeout)
-	srv.frontend_router.SetSndtimeo(srv.timeout)
-	srv.frontend_router.SetRcvtimeo(srv.timeout)
+	srv.backend_router.SetRcvtimeo(zmqTimeout(srv.timeout))
+	srv.backend_router.SetSndtimeo(zmqTimeout(srv.timeout))
+	srv.frontend_router.SetSndtimeo(zmqTimeout(srv.timeout))
+	srv.frontend_router.SetRcvtimeo(zmqTimeout(srv.timeout))
 }
 
 // Set the machine name as shown in traces (os.Hostname() can be used to obtain the DNS name)
@@ -185,6 +296,59 @@ func (srv *Server) SetMachineName(name string) {
 	srv.machine_name = name
 }
 
+/*
+Set the size (in bytes) from which responses are compressed, if the client accepts a codec
+supported by this server. Default: compression.DEFAULT_THRESHOLD
+*/
+func (srv *Server) SetCompressionThreshold(n int) {
+	srv.compression_threshold = n
+}
+
+/*
+Enable adaptive LIFO mode: When more than threshold requests are waiting for a worker, the
+newest one is served first, because its caller is the most likely to still wait for the
+response. This keeps latency low for most requests under overload, at the cost of the
+oldest ones. 0 (default) disables it. Must be called before Start().
+*/
+func (srv *Server) SetAdaptiveLIFO(threshold uint) {
+	srv.lifo_threshold = int(threshold)
+}
+
+/*
+Enable adaptive overload control: If the queueing delay of requests stays above target for
+a whole interval (default: queue.DEFAULT_CODEL_INTERVAL), the server is considered overloaded.
+New requests that find no free worker are then refused, and queued requests that waited
+longer than target are dropped, both with STATUS_OVERLOADED_RETRY and a retry-after hint.
+This keeps latency close to the target under overload, instead of filling the queue (which
+is still limited to OUTSTANDING_REQUESTS_PER_THREAD per worker). A target of 0 (default)
+disables overload control. May be called at any time; when the server is running, the change
+is applied by the load balancer, and the overload state is reset.
+*/
+func (srv *Server) SetOverloadControl(target, interval time.Duration) error {
+	return srv.onBalancer(func(lb *balancer) error {
+		atomic.StoreInt64(&srv.codel_target, int64(target))
+		srv.codel_interval = interval
+
+		if lb != nil {
+			lb.codel = srv.newCodel()
+		}
+		return nil
+	})
+}
+
+// Target queueing delay for overload control; 0 if disabled.
+func (srv *Server) overloadTarget() time.Duration {
+	return time.Duration(atomic.LoadInt64(&srv.codel_target))
+}
+
+// Returns nil if overload control is disabled.
+func (srv *Server) newCodel() *queue.Codel {
+	if target := srv.overloadTarget(); target > 0 {
+		return queue.NewCodel(target, srv.codel_interval)
+	}
+	return nil
+}
+
 /*
 Log all RPCs made by this client to this logging device; either as hex/raw strings or protobuf strings.
 */
@@ -195,63 +359,103 @@ func (cl *Server) SetRPCLogger(l *golog.Logger) {
 /*
 Add a new endpoint (i.e. a handler); svc is the "namespace" in which to register the handler,
 endpoint the name with which the handler can be identified from the outside. The service
-is created implicitly
+is created implicitly. Options can limit the concurrency of the endpoint (see MaxConcurrent())
+and its runtime (see HandlerTimeout()).
 
-err is not nil if the endpoint is already registered.
+err is not nil if the endpoint is already registered, or if svc is the built-in service
+(BUILTIN_SERVICE).
+*/
+func (srv *Server) RegisterHandler(svc, endpoint string, handler Handler, opts ...HandlerOption) (err error) {
+	return srv.registerEndpoint(svc, endpoint, &registeredEndpoint{handler: handler}, opts)
+}
+
+/*
+Like RegisterHandler(), but for a streaming endpoint, which can send several responses to
+one request. Clients call it using Request.GoStream().
+*/
+func (srv *Server) RegisterStreamingHandler(svc, endpoint string, handler StreamHandler, opts ...HandlerOption) (err error) {
+	return srv.registerEndpoint(svc, endpoint, &registeredEndpoint{stream_handler: handler, sends: true}, opts)
+}
+
+/*
+Register a client-streaming endpoint: The handler receives any number of messages from the
+client using ServerStream.Recv() and sets a single response on the Context. Clients call it
+using Request.GoBidiStream().
+*/
+func (srv *Server) RegisterClientStreamingHandler(svc, endpoint string, handler StreamHandler, opts ...HandlerOption) (err error) {
+	return srv.registerEndpoint(svc, endpoint, &registeredEndpoint{stream_handler: handler, receives: true}, opts)
+}
+
+/*
+Register a bidirectional streaming endpoint: The handler can both receive messages from the
+client and send responses. Clients call it using Request.GoBidiStream().
 */
-func (srv *Server) RegisterHandler(svc, endpoint string, handler Handler) (err error) {
-	_, ok := srv.services[svc]
-
-	if !ok {
-		srv.services[svc] = new(service)
-		srv.services[svc].endpoints = make(map[string]Handler)
-	} else if _, ok = srv.services[svc].endpoints[endpoint]; ok {
-		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Trying to register existing endpoint:", svc+"."+endpoint)
-		err = errors.New("Endpoint already registered; not overwritten")
-		return
+func (srv *Server) RegisterBidiStreamingHandler(svc, endpoint string, handler StreamHandler, opts ...HandlerOption) (err error) {
+	return srv.registerEndpoint(svc, endpoint, &registeredEndpoint{stream_handler: handler, sends: true, receives: true}, opts)
+}
+
+func (srv *Server) registerEndpoint(svc, name string, ep *registeredEndpoint, opts []HandlerOption) error {
+	if svc == BUILTIN_SERVICE {
+		return errors.New("The built-in service can't be changed")
 	}
 
-	log.CRPC_log(log.LOGLEVEL_INFO, "Registered endpoint:", svc+"."+endpoint)
+	err := srv.updateRegistry(func(r registry) error {
+		if current, ok := r[svc]; ok {
+			r[svc] = current.clone()
+		} else {
+			r[svc] = newService()
+		}
+		return r[svc].add(name, ep, opts)
+	})
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Trying to register existing endpoint:", svc+"."+name)
+		return err
+	}
 
-	srv.services[svc].endpoints[endpoint] = handler
-	err = nil
-	return
+	log.CRPC_log(log.LOGLEVEL_INFO, "Registered endpoint:", svc+"."+name)
+	return nil
 }
 
 /*
-Removes an endpoint from the set of served endpoints.
+Removes an endpoint from the set of served endpoints. Requests being handled by the
+endpoint are not affected.
 
 Returns an error value with a description if the endpoint doesn't exist.
 */
-func (srv *Server) UnregisterHandler(svc, endpoint string) (err error) {
-
-	err = nil
-	_, ok := srv.services[svc]
+func (srv *Server) UnregisterHandler(svc, endpoint string) error {
+	if svc == BUILTIN_SERVICE {
+		return errors.New("The built-in service can't be changed")
+	}
 
-	if !ok {
-		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Trying to unregister non-existing endpoint: ", svc+"."+endpoint)
+	err := srv.updateRegistry(func(r registry) error {
+		current, ok := r[svc]
 
-		err = errors.New("No such service")
-		return
-	} else if _, ok = srv.services[svc].endpoints[endpoint]; !ok {
-		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Trying to unregister non-existing endpoint: ", svc+"."+endpoint)
+		if !ok {
+			return errors.New("No such service")
+		} else if _, ok = current.endpoints[endpoint]; !ok {
+			return errors.New("No such endpoint")
+		}
 
-		err = errors.New("No such endpoint")
-		return
-	} else {
-		log.CRPC_log(log.LOGLEVEL_INFO, "Unregistered endpoint: ", svc+"."+endpoint)
+		r[svc] = current.clone()
+		delete(r[svc].endpoints, endpoint)
+		return nil
+	})
 
-		delete(srv.services[svc].endpoints, endpoint)
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Trying to unregister non-existing endpoint: ", svc+"."+endpoint)
+		return err
 	}
 
-	return
+	log.CRPC_log(log.LOGLEVEL_INFO, "Unregistered endpoint: ", svc+"."+endpoint)
+	return nil
 }
 
-// Returns a handler, or nil if none was found.
-func (srv *Server) findHandler(service, endpoint string) Handler {
-	if service, ok := srv.services[service]; ok {
-		if handler, ok := service.endpoints[endpoint]; ok {
-			return handler
+// Returns an endpoint, or nil if none was found.
+func (srv *Server) findHandler(service, endpoint string) *registeredEndpoint {
+	if service, ok := srv.services()[service]; ok {
+		if ep, ok := service.endpoints[endpoint]; ok {
+			return ep
 		} else {
 			return nil
 		}
@@ -265,12 +469,22 @@ A server that is in lameduck mode will respond negatively to health checks
 but continue serving requests.
 */
 func (srv *Server) SetLameduck(lameduck bool) {
-	srv.lameduck_state = lameduck
+	if lameduck {
+		atomic.StoreUint32(&srv.lameduck_state, 1)
+		srv.transition(STATE_LAMEDUCK, STATE_SERVING)
+	} else {
+		atomic.StoreUint32(&srv.lameduck_state, 0)
+		srv.transition(STATE_SERVING, STATE_LAMEDUCK)
+	}
 }
 
 /*
 A server in loadshed mode will refuse any requests immediately.
 */
 func (srv *Server) SetLoadshed(loadshed bool) {
-	srv.loadshed_state = loadshed
+	if loadshed {
+		atomic.StoreUint32(&srv.loadshed_state, 1)
+	} else {
+		atomic.StoreUint32(&srv.loadshed_state, 0)
+	}
 }
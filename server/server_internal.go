@@ -3,24 +3,51 @@ package server
 import (
 	"bytes"
 	"fmt"
+	"github.com/dermesser/clusterrpc/compression"
 	"github.com/dermesser/clusterrpc/log"
 	"github.com/dermesser/clusterrpc/proto"
 	"github.com/dermesser/clusterrpc/server/queue"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/gogo/protobuf/proto"
 	zmq "github.com/pebbe/zmq4"
 )
 
+// Prefix of the backend router endpoint; every server has an endpoint of its own (see Server.backend_path).
 const BACKEND_ROUTER_PATH string = "inproc://rpc_backend_router"
 
+// Number of servers created so far, for unique inproc endpoints
+var server_instances uint64
+
 var MAGIC_READY_STRING []byte = []byte("___ReAdY___")
 var MAGIC_STOP_STRING []byte = []byte("___STOPBALANCER___")
 
+// Sent by a worker instead of a response when it has finished a one-way request.
+var MAGIC_ONEWAY_DONE_STRING []byte = []byte("___OnEwAyDoNe___")
+
 const OUTSTANDING_REQUESTS_PER_THREAD uint = 50
 
+// How often the load balancer expires stalled streams and idle callers
+const CLEANUP_INTERVAL time.Duration = time.Second
+
+// Request priorities (see client.RequestParams.Priority()). When the server is busy, requests
+// of higher priority are served first, and requests of lower priority are refused first.
+const (
+	PRIORITY_BATCH       uint32 = 0
+	PRIORITY_NORMAL      uint32 = 1
+	PRIORITY_INTERACTIVE uint32 = 2
+	PRIORITY_CRITICAL    uint32 = 3
+)
+
+// Requests to endpoints of this service are handled by the load balancer itself, so that
+// health checks are answered even if all workers are busy.
+const BUILTIN_SERVICE string = "__CLUSTERRPC"
+
 type workerRequest struct {
 	requestId, clientId, data []byte
+	// Identity of the worker handling the request; empty in the load balancer
+	workerId string
 }
 
 /*
@@ -28,21 +55,13 @@ This file has the internal functions, the actual server; server.go remains
 uncluttered and with only public functions.
 */
 
-func (srv *Server) stop() error {
-	log.CRPC_log(log.LOGLEVEL_INFO, "Stopping workers...")
-
-	// First stop all worker threads
-	for i := uint(0); i < srv.workers; i++ {
-		_, err := srv.backend_router.SendMessage(
-			newBackendMessage([]byte(fmt.Sprintf("%d", i)),
-				newClientMessage([]byte("BOGUS_RQID"), []byte{0xde, 0xad, 0xde, 0xad}, MAGIC_STOP_STRING)).serializeBackendMessage())
-		if err != nil {
-			log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not send stop message to load balancer, exiting!", err.Error())
-
-			return err
-		}
-	}
+// The load balancer stops the workers before it stops itself. Only the first call has an effect.
+func (srv *Server) stop() (err error) {
+	srv.stop_once.Do(func() { err = srv.stopBalancer() })
+	return err
+}
 
+func (srv *Server) stopBalancer() error {
 	sock, err := zmq.NewSocket(zmq.REQ)
 
 	log.CRPC_log(log.LOGLEVEL_DEBUG, "Stopping balancer thread...")
@@ -62,7 +81,7 @@ func (srv *Server) stop() error {
 		return err
 	}
 
-	err = sock.Connect(BACKEND_ROUTER_PATH)
+	err = sock.Connect(srv.backend_path)
 
 	if err != nil {
 		log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not connect to load balancer thread, exiting!", err.Error())
@@ -94,10 +113,67 @@ func (srv *Server) stop() error {
 	return nil
 }
 
-func (srv *Server) handleIncomingRpc(worker_queue *queue.Queue, request_queue *queue.Queue) {
+// State of the load balancer; only accessed by the load balancer goroutine.
+type balancer struct {
+	// Queue of worker IDs ([]byte)
+	worker_queue queue.Queue
+	// Queue of *lbRequest by priority and caller, for requests that find no available worker immediately.
+	request_queue queue.MultiQueue
+
+	// Open streams by streamKey(), and the keys of streams by the ID of the worker serving them.
+	streams        map[string]*lbStream
+	worker_streams map[string]string
+
+	// nil if overload control is disabled
+	codel *queue.Codel
+
+	// Callers with quotas, and the callers of requests counted against quotas by the ID of the worker handling them.
+	callers        map[string]*callerState
+	worker_callers map[string]string
+
+	// Bulkheads by endpoint or service name, and the bulkheads of requests by the ID of the worker handling them.
+	bulkheads        map[string]*bulkhead
+	worker_bulkheads map[string][]*bulkhead
+
+	// Number of workers that are running or starting, not counting those to be retired once
+	// they are idle (retiring). live_workers has the IDs of workers that have reported ready.
+	workers, retiring int
+	next_worker       uint
+	live_workers      map[string]bool
+
+	// Autoscaling (see SetAutoscaling()); disabled if autoscale_max == 0. peak_busy is the
+	// highest number of busy workers since the last adjustment.
+	autoscale_min, autoscale_max int
+	peak_busy                    int
+	last_autoscale               time.Time
+
+	// Last time stalled streams and idle callers were expired
+	last_cleanup time.Time
+
+	// Closed once there are no queued or running requests anymore, if set (see Shutdown())
+	drained chan struct{}
+}
+
+// A request as seen by the load balancer.
+type lbRequest struct {
+	message clientMessage
+	request *proto.RPCRequest
+	// Zero if the caller didn't send a timeout
+	deadline time.Time
+	// Zero if the request was dispatched immediately
+	enqueued time.Time
+	// Identifies the caller for quotas and fair queuing (see callerKey())
+	caller string
+	// Whether the request counts against its caller's quota
+	counted bool
+	// Concurrency limits of the endpoint and its service
+	bulkheads []*bulkhead
+}
+
+func (srv *Server) handleIncomingRpc(lb *balancer) {
 	// The message we're receiving here has this format: [requestId, clientIdentity, "", data].
 	// See documentation about REQ_CORRELATE.
-	msgs, err := srv.frontend_router.RecvMessageBytes(0)
+	msgs, metadata, err := srv.frontend_router.RecvMessageBytesWithMetadata(0, ZAP_USER_ID)
 
 	if err != nil {
 		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when receiving from frontend:", err.Error())
@@ -105,56 +181,212 @@ func (srv *Server) handleIncomingRpc(worker_queue *queue.Queue, request_queue *q
 	}
 
 	message := parseClientMessage(msgs)
+	defer srv.updateStats(lb)
 
-	if srv.loadshed_state { // Refuse request.
-		request := &proto.RPCRequest{}
-		err = request.Unmarshal(message.payload)
+	request := &proto.RPCRequest{}
+	err = request.Unmarshal(message.payload)
 
-		if err != nil {
-			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Dropped message; could not decode protobuf:", err.Error())
-			return
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, fmt.Sprintf("[%x/_/_] PB unmarshaling error: %s", message.clientId, err.Error()))
+		srv.sendError(srv.frontend_router, request, proto.RPCResponse_STATUS_SERVER_ERROR,
+			&workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload})
+		return
+	}
+
+	// Messages on an already open stream (credit, data, half-close, cancellation) are marked
+	// by the client and are not requests of their own. They are dropped if the stream has
+	// ended already, so that they can't open it again.
+	if request.GetStreamMessage() {
+		if stream, ok := lb.streams[streamKey(message, request)]; ok {
+			srv.handleStreamMessage(stream, message, request)
+		} else if log.IsLoggingEnabled(log.LOGLEVEL_DEBUG) {
+			log.CRPC_log(log.LOGLEVEL_DEBUG, "Dropping message for closed stream", request.GetStreamId())
 		}
+		return
+	} else if _, ok := lb.streams[streamKey(message, request)]; ok && request.GetStreamId() != "" {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Dropping request opening a stream that is already open:", request.GetStreamId())
+		return
+	}
 
+	atomic.AddUint64(&srv.stats.received, 1)
+
+	// Health checks are answered even while shedding load or shutting down, so that load
+	// balancers learn about the lameduck state. They bypass the queue.
+	if request.GetSrvc() == BUILTIN_SERVICE {
+		srv.handleBuiltin(request, message)
+		return
+	}
+
+	rq := &lbRequest{message: message, request: request, deadline: requestDeadline(request, time.Now()),
+		caller: callerKey(request, metadata[ZAP_USER_ID])}
+	rq.bulkheads = srv.bulkheadsFor(lb, request)
+
+	if deadlinePassed(rq.deadline, time.Now()) {
+		atomic.AddUint64(&srv.stats.expired, 1)
+		srv.sendError(srv.frontend_router, request, proto.RPCResponse_STATUS_MISSED_DEADLINE,
+			&workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload})
+
+	} else if srv.isLoadshed() { // Refuse request.
+		atomic.AddUint64(&srv.stats.loadshed, 1)
 		srv.sendError(srv.frontend_router, request, proto.RPCResponse_STATUS_LOADSHED,
 			&workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload})
 
-	} else if worker_id, ok := worker_queue.Pop().([]byte); ok { // Find worker
-		_, err = srv.backend_router.SendMessage(newBackendMessage(worker_id, message).serializeBackendMessage()) // [worker identity, "", request identity, client identity, "", RPCRequest]
+	} else if !srv.admit(lb, rq) {
+		atomic.AddUint64(&srv.stats.quota_exceeded, 1)
+		srv.sendError(srv.frontend_router, request, proto.RPCResponse_STATUS_QUOTA_EXCEEDED,
+			&workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload})
 
-		if err != nil {
-			if err.(zmq.Errno) != zmq.EHOSTUNREACH {
-				log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when sending to backend router:", err.Error())
-			} else {
-				log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not route message, identity", fmt.Sprintf("%x", message.clientId), ", to frontend")
-			}
+	} else if b := lb.blockedBy(rq); b != nil { // Concurrency limit of the endpoint reached
+		srv.holdBack(lb, rq, b)
+
+	} else if worker_id, ok := lb.worker_queue.Pop().([]byte); ok { // Find worker
+		if lb.codel != nil {
+			lb.codel.Dequeued(0, time.Now())
 		}
+		lb.openStream(rq)
+		srv.dispatch(lb, worker_id, rq)
+
+	} else {
+		srv.enqueue(lb, rq)
+	}
 
-	} else if uint(request_queue.Len()) < srv.workers*OUTSTANDING_REQUESTS_PER_THREAD { // We're only allowing so many queued requests to prevent from complete overloading
-		request_queue.Push(message)
+}
 
-		if request_queue.Len() > int(0.8*float64(srv.workers*OUTSTANDING_REQUESTS_PER_THREAD)) {
-			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Queue is now at more than 80% fullness. Consider increasing # of workers: (qlen/cap)",
-				request_queue.Len(), srv.workers*OUTSTANDING_REQUESTS_PER_THREAD)
+/*
+Queue a request that finds no free worker. If the queue is full, or overload control doesn't
+admit new requests, a queued request of lower priority, or of a caller with more queued
+requests, is refused to make room (see MultiQueue.Evict()); if there is none, the request
+itself is refused.
+*/
+func (srv *Server) enqueue(lb *balancer, rq *lbRequest) {
+	// We're only allowing so many queued requests to prevent from complete overloading
+	full := lb.request_queue.Len() >= lb.request_queue.Capacity()
+	overloaded := lb.codel != nil && lb.codel.Overloaded()
 
+	if full || overloaded {
+		victim, ok := lb.request_queue.Evict(int(rq.request.GetPriority()), rq.caller).(*lbRequest)
+
+		if !ok {
+			srv.refuse(lb, rq)
+			return
 		}
+		srv.refuse(lb, victim)
+	}
+
+	lb.openStream(rq)
+	rq.enqueued = time.Now()
+	lb.request_queue.Push(int(rq.request.GetPriority()), rq.caller, rq)
+
+	if lb.request_queue.Len() > int(0.8*float64(lb.request_queue.Capacity())) {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Queue is now at more than 80% fullness. Consider increasing # of workers: (qlen/cap)",
+			lb.request_queue.Len(), lb.request_queue.Capacity())
+	}
+}
+
+// Refuse a request (possibly a queued one) because the server is overloaded.
+func (srv *Server) refuse(lb *balancer, rq *lbRequest) {
+	if rq.counted {
+		lb.release(rq.caller)
+	}
+
+	if !rq.enqueued.IsZero() && rq.request.GetStreamId() != "" {
+		delete(lb.streams, streamKey(rq.message, rq.request))
+	}
+
+	if lb.codel != nil && lb.codel.Overloaded() {
+		atomic.AddUint64(&srv.stats.shed, 1)
+		srv.sendOverloaded(lb, rq.request, rq.message)
 	} else {
+		atomic.AddUint64(&srv.stats.overloaded, 1)
 		// Maybe just drop silently -- this costs CPU!
-		request := &proto.RPCRequest{}
-		err = request.Unmarshal(message.payload)
+		srv.sendError(srv.frontend_router, rq.request, proto.RPCResponse_STATUS_OVERLOADED_RETRY,
+			&workerRequest{clientId: rq.message.clientId, requestId: rq.message.requestId, data: rq.message.payload})
+	}
+}
 
-		if err != nil {
-			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Dropped message; no available workers, queue full")
-			return
-		}
+// Handle a request to a built-in endpoint in the load balancer. These handlers must be fast.
+func (srv *Server) handleBuiltin(request *proto.RPCRequest, message clientMessage) {
+	ep := srv.findHandler(request.GetSrvc(), request.GetProcedure())
 
-		srv.sendError(srv.frontend_router, request, proto.RPCResponse_STATUS_OVERLOADED_RETRY,
+	if ep == nil || ep.handler == nil {
+		srv.sendError(srv.frontend_router, request, proto.RPCResponse_STATUS_NOT_FOUND,
 			&workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload})
+		return
+	}
+
+	cx := srv.newContext(request, srv.rpclogger)
+	atomic.AddUint64(&srv.stats.processed, 1)
+	ep.handler(cx)
+
+	response := cx.toRPCResponse()
+	response.RpcId = request.RpcId
+
+	if request.GetOneWay() {
+		return
+	}
+
+	buf, err := response.Marshal()
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when serializing RPCResponse:", err.Error())
+		return
+	}
+	srv.forwardResponse(newBackendMessage(nil, newClientMessage(message.requestId, message.clientId, buf)))
+}
+
+// Send a request to a worker.
+func (srv *Server) dispatch(lb *balancer, worker_id []byte, rq *lbRequest) {
+	if rq.request.GetStreamId() != "" {
+		key := streamKey(rq.message, rq.request)
+		lb.streams[key].worker = worker_id
+		lb.worker_streams[string(worker_id)] = key
+	}
+
+	if rq.counted {
+		lb.worker_callers[string(worker_id)] = rq.caller
+	}
+	lb.enterBulkheads(worker_id, rq)
+	lb.recordBusy()
+
+	// Tell the worker how long the request waited, and how much time is left.
+	modified := true
+
+	if !rq.enqueued.IsZero() {
+		wait := time.Now().Sub(rq.enqueued)
+		atomic.AddUint64(&srv.stats.queued, 1)
+		atomic.AddInt64(&srv.stats.queue_wait, int64(wait))
+
+		rq.request.QueueTime = pb.Int64(int64(wait / time.Microsecond))
+
+		if !rq.deadline.IsZero() {
+			rq.request.TimeoutBudget = pb.Int64(int64(rq.deadline.Sub(time.Now()) / time.Microsecond))
+			rq.request.Deadline = nil
+		}
+	} else if rq.request.QueueTime != nil {
+		rq.request.QueueTime = nil
+	} else {
+		modified = false
 	}
 
+	if modified {
+		if payload, err := rq.request.Marshal(); err == nil {
+			rq.message.payload = payload
+		}
+	}
+
+	_, err := srv.backend_router.SendMessage(newBackendMessage(worker_id, rq.message).serializeBackendMessage()) // [worker identity, "", request identity, client identity, "", RPCRequest]
+
+	if err != nil {
+		if err.(zmq.Errno) != zmq.EHOSTUNREACH {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when sending to backend router:", err.Error())
+		} else {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not route message, identity", fmt.Sprintf("%x", rq.message.clientId), ", to frontend")
+		}
+	}
 }
 
 // Returns false if the server loop should be stopped
-func (srv *Server) handleWorkerResponse(worker_queue *queue.Queue, request_queue *queue.Queue) bool {
+func (srv *Server) handleWorkerResponse(lb *balancer) bool {
 	msgs, err := srv.backend_router.RecvMessageBytes(0) // [worker identity, "", requestId, client identity, "", RPCResponse]
 
 	if err != nil {
@@ -163,15 +395,26 @@ func (srv *Server) handleWorkerResponse(worker_queue *queue.Queue, request_queue
 	}
 
 	message := parseBackendMessage(msgs)
+	defer srv.updateStats(lb)
+
+	var released []*bulkhead
 
-	// the data frame is MAGIC_READY_STRING when a worker joins, and MAGIC_STOP_STRING
+	// the data frame is MAGIC_READY_STRING when a worker joins, MAGIC_ONEWAY_DONE_STRING
+	// after handling a one-way request (no response to forward), and MAGIC_STOP_STRING
 	// if the app asks to stop
-	if bytes.Equal(message.message.payload, MAGIC_READY_STRING) {
+	if bytes.Equal(message.message.payload, MAGIC_READY_STRING) ||
+		bytes.Equal(message.message.payload, MAGIC_ONEWAY_DONE_STRING) {
 
-		worker_queue.Push(message.workerId)
+		lb.live_workers[string(message.workerId)] = true
+		lb.releaseWorker(message.workerId)
+		released = lb.leaveBulkheads(message.workerId)
+		srv.workerAvailable(lb, message.workerId)
 
 	} else if bytes.Equal(message.message.payload, MAGIC_STOP_STRING) {
 
+		log.CRPC_log(log.LOGLEVEL_INFO, "Stopping workers...")
+		srv.stopWorkers(lb)
+
 		log.CRPC_log(log.LOGLEVEL_INFO, "Stopped balancer...")
 
 		// Send ack
@@ -182,33 +425,111 @@ func (srv *Server) handleWorkerResponse(worker_queue *queue.Queue, request_queue
 		}
 		return false
 
-	} else {
-		worker_queue.Push(message.workerId)
-		_, err := srv.frontend_router.SendMessage(msgs[2:]) // [request identity, client identity, "", RPCResponse]
+	} else if srv.handleStreamResponse(lb, message) {
+		// The worker is still busy with a stream.
+		return true
 
-		if err != nil {
-			if err.(zmq.Errno) != zmq.EHOSTUNREACH {
-				log.CRPC_log(log.LOGLEVEL_WARNINGS, "Error when sending to backend router:", err.Error())
-			} else if err.(zmq.Errno) == zmq.EHOSTUNREACH {
-				// routing is mandatory.
-				// Fails when the client has already disconnected
-				log.CRPC_log(log.LOGLEVEL_WARNINGS, "Could not route message, worker identity", fmt.Sprintf("%x", message.workerId), "to frontend")
-			}
-		}
+	} else {
+		lb.releaseWorker(message.workerId)
+		released = lb.leaveBulkheads(message.workerId)
+		srv.forwardResponse(message)
+		srv.workerAvailable(lb, message.workerId)
 	}
 
+	// Requests held back by concurrency limits go first, those of the finished request before others.
+	srv.scheduleBulkheads(lb, released)
+
 	// Now that we have a new free worker, let's see if there's work in the queue...
-	if request_queue.Len() > 0 && worker_queue.Len() > 0 {
-		request_message := request_queue.Pop().(clientMessage)
-		worker_id := worker_queue.Pop().([]byte)
-		_, err := srv.backend_router.SendMessage(newBackendMessage(worker_id, request_message).serializeBackendMessage())
-		if err != nil {
-			log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when sending to backend router:", err.Error())
+	for lb.request_queue.Len() > 0 && lb.worker_queue.Len() > 0 {
+		var rq *lbRequest
+
+		if srv.lifo_threshold > 0 && lb.request_queue.Len() > srv.lifo_threshold {
+			rq = lb.request_queue.PopBack().(*lbRequest)
+		} else {
+			rq = lb.request_queue.Pop().(*lbRequest)
+		}
+
+		if srv.dropExpired(lb, rq) {
+			continue
+		}
+
+		if b := lb.blockedBy(rq); b != nil {
+			srv.holdBack(lb, rq, b)
+			continue
 		}
+
+		if lb.codel != nil && lb.codel.Dequeued(time.Now().Sub(rq.enqueued), time.Now()) {
+			srv.refuse(lb, rq)
+			continue
+		}
+
+		worker_id := lb.worker_queue.Pop().([]byte)
+		srv.dispatch(lb, worker_id, rq)
+		break
+	}
+	return true
+}
+
+// Refuse a queued request if the caller has given up while it was queued. Returns true if it was refused.
+func (srv *Server) dropExpired(lb *balancer, rq *lbRequest) bool {
+	if !deadlinePassed(rq.deadline, time.Now()) {
+		return false
+	}
+
+	atomic.AddUint64(&srv.stats.expired, 1)
+
+	if rq.counted {
+		lb.release(rq.caller)
+	}
+	if rq.request.GetStreamId() != "" {
+		delete(lb.streams, streamKey(rq.message, rq.request))
 	}
+	srv.sendError(srv.frontend_router, rq.request, proto.RPCResponse_STATUS_MISSED_DEADLINE,
+		&workerRequest{clientId: rq.message.clientId, requestId: rq.message.requestId, data: rq.message.payload})
 	return true
 }
 
+// Send a response from a worker to the client.
+func (srv *Server) forwardResponse(message backendMessage) {
+	_, err := srv.frontend_router.SendMessage(message.message.serializeClientMessage()) // [request identity, client identity, "", RPCResponse]
+
+	if err != nil {
+		if err.(zmq.Errno) != zmq.EHOSTUNREACH {
+			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Error when sending to backend router:", err.Error())
+		} else if err.(zmq.Errno) == zmq.EHOSTUNREACH {
+			// routing is mandatory.
+			// Fails when the client has already disconnected
+			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Could not route message, worker identity", fmt.Sprintf("%x", message.workerId), "to frontend")
+		}
+	}
+}
+
+// Refuse a request because of overload, telling the client when to retry.
+func (srv *Server) sendOverloaded(lb *balancer, request *proto.RPCRequest, message clientMessage) {
+	srv.sendErrorRetryAfter(srv.frontend_router, request, proto.RPCResponse_STATUS_OVERLOADED_RETRY,
+		&workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload},
+		lb.codel.RetryAfter())
+}
+
+// Publish the state of the load balancer for GetStats()
+func (srv *Server) updateStats(lb *balancer) {
+	atomic.StoreInt64(&srv.stats.queue_length, int64(lb.request_queue.Len()))
+	atomic.StoreInt64(&srv.stats.workers, int64(lb.workers))
+	atomic.StoreInt64(&srv.stats.busy_workers, int64(lb.busyWorkers()))
+
+	if lb.codel != nil {
+		var overloaded uint32
+		if lb.codel.Overloaded() {
+			overloaded = 1
+		}
+		atomic.StoreUint32(&srv.stats.overload_control, overloaded)
+		atomic.StoreInt64(&srv.stats.min_queue_delay, int64(lb.codel.MinDelay()))
+	} else {
+		atomic.StoreUint32(&srv.stats.overload_control, 0)
+		atomic.StoreInt64(&srv.stats.min_queue_delay, 0)
+	}
+}
+
 /*
 Load balancer using the least used worker: We have a list (queue) of backend worker identities;
 a backend is queued when it sends a response, and dequeued when it is sent a client request.
@@ -216,26 +537,46 @@ a backend is queued when it sends a response, and dequeued when it is sent a cli
 Additionally, there's a request queue for the case that there are no workers available at the moment.
 This queue is consulted every time a worker has completed a request, which results in a relatively
 good resource efficiency.
+
+A worker serving a stream stays bound to it until it sends the final response of the stream.
+
+The load balancer also executes commands from other goroutines (see sendCommand()), e.g. for
+changing the number of workers.
 */
 func (srv *Server) loadbalance() {
 	srv.lblock.Lock()
 	defer srv.lblock.Unlock()
+	defer srv.stopped()
+
+	lb := balancer{
+		worker_queue: queue.NewQueue(int(srv.workers)),
+		// request_queue is for incoming requests that find no available worker immediately.
+		// We're allowing a backlog of 50 outstanding requests per task; over that, we're dropping
+		request_queue:  queue.NewMultiQueue(int(PRIORITY_CRITICAL)+1, int(srv.workers*OUTSTANDING_REQUESTS_PER_THREAD)),
+		streams:        make(map[string]*lbStream),
+		worker_streams: make(map[string]string),
+		callers:        make(map[string]*callerState),
+		worker_callers: make(map[string]string),
+
+		bulkheads:        make(map[string]*bulkhead),
+		worker_bulkheads: make(map[string][]*bulkhead),
+
+		// The initial workers are started by Start().
+		workers:      int(srv.workers),
+		next_worker:  srv.workers,
+		live_workers: make(map[string]bool),
+	}
 
-	// Queue of []byte
-	worker_queue := queue.NewQueue(int(srv.workers))
-
-	// request_queue is for incoming requests that find no available worker immediately.
-	// We're allowing a backlog of 50 outstanding requests per task; over that, we're dropping
-	//
-	// Queue of [][]byte!
-	request_queue := queue.NewQueue(50)
+	lb.codel = srv.newCodel()
 
 	poller := zmq.NewPoller()
 	poller.Add(srv.frontend_router, zmq.POLLIN)
 	poller.Add(srv.backend_router, zmq.POLLIN)
+	poller.Add(srv.command_pull, zmq.POLLIN)
 
 	for {
-		polled, err := poller.Poll(-1)
+		// Wake up regularly to expire stalled streams.
+		polled, err := poller.Poll(time.Second)
 
 		if err != nil {
 			log.CRPC_log(log.LOGLEVEL_ERRORS, "Polling error in loadbalancer:", err.Error())
@@ -244,17 +585,34 @@ func (srv *Server) loadbalance() {
 			for _, sock := range polled {
 				switch s := sock.Socket; s {
 				case srv.frontend_router:
-					srv.handleIncomingRpc(&worker_queue, &request_queue)
+					srv.handleIncomingRpc(&lb)
 				case srv.backend_router:
-					if !srv.handleWorkerResponse(&worker_queue, &request_queue) {
+					if !srv.handleWorkerResponse(&lb) {
 						return
 					}
+				case srv.command_pull:
+					srv.handleCommands(&lb)
 				}
 			}
 		}
+
+		srv.cleanup(&lb)
+		srv.autoscale(&lb)
+		srv.checkDrained(&lb)
+		srv.updateStats(&lb)
 	}
 }
 
+// Expire stalled streams and idle callers, at most once per CLEANUP_INTERVAL.
+func (srv *Server) cleanup(lb *balancer) {
+	if time.Now().Sub(lb.last_cleanup) < CLEANUP_INTERVAL {
+		return
+	}
+	srv.expireStreams(lb)
+	srv.expireCallers(lb)
+	lb.last_cleanup = time.Now()
+}
+
 // Start a single worker thread; spawn a goroutine if spawn == true. Otherwise, execute in
 // the current thread. This thread will later execute the registered handlers.
 func (srv *Server) thread(n uint, spawn bool) error {
@@ -277,7 +635,7 @@ func (srv *Server) thread(n uint, spawn bool) error {
 		return err
 	}
 
-	err = sock.Connect(BACKEND_ROUTER_PATH)
+	err = sock.Connect(srv.backend_path)
 
 	if err != nil {
 		log.CRPC_log(log.LOGLEVEL_ERRORS, "Thread", n, "could not connect to backend router, exiting!")
@@ -285,7 +643,7 @@ func (srv *Server) thread(n uint, spawn bool) error {
 		return err
 	}
 
-	sock.SetSndtimeo(srv.timeout)
+	sock.SetSndtimeo(zmqTimeout(srv.timeout))
 
 	if spawn {
 		go srv.acceptRequests(sock, worker_identity)
@@ -315,10 +673,12 @@ func (srv *Server) acceptRequests(sock *zmq.Socket, worker_identity string) erro
 
 			if bytes.Equal(message.payload, MAGIC_STOP_STRING) {
 				log.CRPC_log(log.LOGLEVEL_DEBUG, fmt.Sprintf("Worker #%s stopped", worker_identity))
+				sock.Close()
 				return nil
 			}
 
-			req := workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload}
+			req := workerRequest{clientId: message.clientId, requestId: message.requestId, data: message.payload,
+				workerId: worker_identity}
 			srv.handleRequest(&req, sock)
 		} else {
 			if err != nil {
@@ -348,20 +708,35 @@ func (srv *Server) handleRequest(request *workerRequest, sock *zmq.Socket) {
 	caller_id := rqproto.GetCallerId()
 
 	// It is already too late... we can discard this request
-	if rqproto.GetDeadline() > 0 && time.Now().Unix() > rqproto.GetDeadline() {
-		delta := time.Now().Unix() - rqproto.GetDeadline()
-
-		log.CRPC_log(log.LOGLEVEL_WARNINGS, fmt.Sprintf("[%x/%s/%s] Timeout occurred, deadline was %d (%d s)",
-			request.clientId, caller_id, rqproto.GetRpcId(), rqproto.GetDeadline(), delta))
+	if deadline := requestDeadline(rqproto, time.Now()); deadlinePassed(deadline, time.Now()) {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, fmt.Sprintf("[%x/%s/%s] Timeout occurred, deadline passed %v ago",
+			request.clientId, caller_id, rqproto.GetRpcId(), time.Now().Sub(deadline)))
 
 		// Sending this to get the REQ socket in the right state
 		srv.sendError(sock, rqproto, proto.RPCResponse_STATUS_MISSED_DEADLINE, request)
 		return
 	}
 
-	handler := srv.findHandler(rqproto.GetSrvc(), rqproto.GetProcedure())
+	if rqproto.GetCompression() != "" {
+		data, err := compression.Decompress(rqproto.GetCompression(), rqproto.GetData())
+
+		if err != nil {
+			log.CRPC_log(log.LOGLEVEL_WARNINGS, fmt.Sprintf("[%x/%s/%s] Could not decompress request: %s",
+				request.clientId, caller_id, rqproto.GetRpcId(), err.Error()))
+
+			status := proto.RPCResponse_STATUS_SERVER_ERROR
+			if compression.Get(rqproto.GetCompression()) == nil {
+				status = proto.RPCResponse_STATUS_UNSUPPORTED_COMPRESSION
+			}
+			srv.sendError(sock, rqproto, status, request)
+			return
+		}
+		rqproto.Data = data
+	}
+
+	ep := srv.findHandler(rqproto.GetSrvc(), rqproto.GetProcedure())
 
-	if handler == nil {
+	if ep == nil {
 		log.CRPC_log(log.LOGLEVEL_WARNINGS,
 			fmt.Sprintf("[%x/%s/%s] NOT_FOUND response to request for endpoint %s",
 				request.clientId, caller_id, rqproto.GetRpcId(), rqproto.GetSrvc()+"."+rqproto.GetProcedure()))
@@ -376,13 +751,83 @@ func (srv *Server) handleRequest(request *workerRequest, sock *zmq.Socket) {
 	}
 
 	cx := srv.newContext(rqproto, srv.rpclogger)
+	cx.reply_to = request
+	sampled := srv.sampler.sample()
+
+	// A detached Context is tracked until its response is sent.
+	detached := false
+	srv.trackContext(cx)
+	defer func() {
+		if !detached {
+			srv.untrackContext(cx)
+		}
+	}()
+
+	if sampled {
+		cx.startTrace(srv.machine_name)
+	}
+
+	atomic.AddUint64(&srv.stats.processed, 1)
+	start := time.Now()
+
+	var stream *ServerStream
+
+	if ep.stream_handler != nil && rqproto.GetStreamId() != "" {
+		stream = &ServerStream{sock: sock, request: request, rpc_id: rqproto.GetRpcId(),
+			sends: ep.sends, receives: ep.receives}
+	}
 
 	// Actual invocation of handler!!
-	handler(cx)
+	timeout := srv.handlerTimeout(rqproto.GetSrvc(), ep)
+	ok, timed_out := srv.runHandler(ep, cx, stream, timeout)
+
+	if timed_out {
+		srv.sendError(sock, rqproto, proto.RPCResponse_STATUS_TIMEOUT, request)
+		return
+	}
+	if !ok {
+		// Leave the socket in a consistent state.
+		srv.sendError(sock, rqproto, proto.RPCResponse_STATUS_SERVER_ERROR, request)
+		return
+	}
+
+	// The response is sent later by Context.Respond(); the worker is free now.
+	if detached = cx.isDetached(); detached {
+		if timeout > 0 {
+			srv.watchDetached(cx, timeout-time.Now().Sub(start))
+		}
+		srv.sendOneWayDone(sock, request)
+
+		if log.IsLoggingEnabled(log.LOGLEVEL_DEBUG) {
+			log.CRPC_log(log.LOGLEVEL_DEBUG, fmt.Sprintf("[%x/%s/%s] Handler detached.", request.clientId, caller_id, rqproto.GetRpcId()))
+		}
+		return
+	}
 
 	rpproto := cx.toRPCResponse()
 	rpproto.RpcId = rqproto.RpcId
 
+	if stream != nil {
+		rpproto.StreamSeq = pb.Uint64(stream.seq)
+	}
+
+	srv.compressResponse(rqproto, rpproto)
+
+	if sampled {
+		srv.sampler.record(SampledRPC{Time: start, Endpoint: rqproto.GetSrvc() + "." + rqproto.GetProcedure(),
+			CallerId: caller_id, RpcId: rqproto.GetRpcId(), Status: rpproto.GetResponseStatus(),
+			Duration: time.Now().Sub(start), Trace: cx.this_call})
+	}
+
+	if rqproto.GetOneWay() {
+		srv.sendOneWayDone(sock, request)
+
+		if log.IsLoggingEnabled(log.LOGLEVEL_DEBUG) {
+			log.CRPC_log(log.LOGLEVEL_DEBUG, fmt.Sprintf("[%x/%s/%s] Finished one-way request.", request.clientId, caller_id, rqproto.GetRpcId()))
+		}
+		return
+	}
+
 	response_serialized, pberr := rpproto.Marshal()
 
 	if pberr != nil {
@@ -411,8 +856,46 @@ func (srv *Server) handleRequest(request *workerRequest, sock *zmq.Socket) {
 	}
 }
 
+// Compress the response data if the client accepts a codec we support and it's large enough.
+func (srv *Server) compressResponse(rq *proto.RPCRequest, rp *proto.RPCResponse) {
+	codec := compression.Get(rq.GetAcceptCompression())
+
+	if codec == nil || len(rp.ResponseData) < srv.compression_threshold {
+		return
+	}
+
+	data, err := codec.Compress(rp.ResponseData)
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Could not compress response, sending it uncompressed:", err.Error())
+		return
+	}
+
+	rp.ResponseData = data
+	rp.Compression = pb.String(codec.Name())
+}
+
+// Tell the load balancer that this worker is free again, without sending a response to the client.
+func (srv *Server) sendOneWayDone(sock *zmq.Socket, request *workerRequest) {
+	sock.SendMessage(newClientMessage(request.requestId, request.clientId, MAGIC_ONEWAY_DONE_STRING).serializeClientMessage())
+}
+
 // "one-shot" -- doesn't catch Write() errors. But needs a lot of context
 func (srv *Server) sendError(sock *zmq.Socket, rq *proto.RPCRequest, s proto.RPCResponse_Status, request *workerRequest) {
+	srv.sendErrorRetryAfter(sock, rq, s, request, 0)
+}
+
+// Like sendError(), with a hint when to retry (if retry_after > 0)
+func (srv *Server) sendErrorRetryAfter(sock *zmq.Socket, rq *proto.RPCRequest, s proto.RPCResponse_Status, request *workerRequest, retry_after time.Duration) {
+	// Nobody waits for the response to a one-way request; a worker only has to return to
+	// the load balancer.
+	if rq.GetOneWay() {
+		if sock != srv.frontend_router {
+			srv.sendOneWayDone(sock, request)
+		}
+		return
+	}
+
 	// The context functions do most of the work for us.
 	tmp_ctx := srv.newContext(rq, nil)
 	tmp_ctx.Fail(s.String())
@@ -421,6 +904,10 @@ func (srv *Server) sendError(sock *zmq.Socket, rq *proto.RPCRequest, s proto.RPC
 	response.RpcId = rq.RpcId
 	response.ResponseStatus = s.Enum()
 
+	if retry_after > 0 {
+		response.RetryAfter = pb.Int64(int64(retry_after / time.Microsecond))
+	}
+
 	buf, err := pb.Marshal(response)
 
 	if err != nil {
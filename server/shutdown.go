@@ -0,0 +1,156 @@
+package server
+
+/*
+* Graceful shutdown: The server stops accepting new requests, but the load balancer keeps
+* dispatching queued requests and forwarding responses until it has nothing left to do (it is
+* "drained"). Only then are the workers and the load balancer stopped.
+ */
+
+import (
+	"context"
+	"errors"
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	"sync/atomic"
+	"time"
+)
+
+// Time handlers have to return after their Contexts were canceled by Shutdown().
+const SHUTDOWN_GRACE_PERIOD time.Duration = time.Second
+
+/*
+Shut down the server gracefully: Enter lameduck mode and refuse new requests (like in loadshed
+mode), but let queued and running requests, including streams and detached requests (see
+Context.Detach()), finish. If ctx expires before that, queued requests are refused, the
+Contexts of running handlers are canceled (see Context.Done()), and ctx.Err() is returned;
+responses of handlers returning within SHUTDOWN_GRACE_PERIOD are still sent. In any case, the
+workers and the load balancer are stopped and the server is closed afterwards; Start() returns.
+*/
+func (srv *Server) Shutdown(ctx context.Context) error {
+	if srv.transition(STATE_STOPPED, STATE_CREATED) {
+		// Never served
+		srv.stopped()
+		srv.Close()
+		return nil
+	}
+
+	srv.SetLameduck(true)
+	srv.SetLoadshed(true)
+
+	if !srv.transition(STATE_DRAINING, STATE_SERVING, STATE_LAMEDUCK) {
+		return errors.New("Server is already shutting down or stopped")
+	}
+
+	log.CRPC_log(log.LOGLEVEL_INFO, "Shutting down server...")
+
+	drained := make(chan struct{})
+	err := srv.sendCommand(func(lb *balancer) {
+		lb.drained = drained
+		srv.checkDrained(lb)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-drained:
+	case <-srv.done:
+		// Stopped by Stop()
+	case <-ctx.Done():
+		err = ctx.Err()
+		srv.exit(err)
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Server not drained before shutdown deadline, canceling remaining requests")
+
+		flushed := make(chan struct{})
+		if srv.sendCommand(func(lb *balancer) { srv.flushQueues(lb); close(flushed) }) == nil {
+			select {
+			case <-flushed:
+			case <-srv.done:
+			}
+		}
+		srv.cancelContexts()
+
+		// Give the canceled handlers a chance to return, so that their responses are still sent.
+		grace := time.NewTimer(SHUTDOWN_GRACE_PERIOD)
+		select {
+		case <-drained:
+		case <-srv.done:
+		case <-grace.C:
+			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Canceled requests didn't finish within", SHUTDOWN_GRACE_PERIOD)
+		}
+		grace.Stop()
+	}
+
+	if stoperr := srv.stop(); stoperr != nil {
+		return stoperr
+	}
+	srv.Close()
+	return err
+}
+
+// Signal a waiting Shutdown() if there are no queued or running requests anymore. Called by the load balancer.
+func (srv *Server) checkDrained(lb *balancer) {
+	if lb.drained == nil || lb.request_queue.Len() > 0 || lb.busyWorkers() > 0 || len(lb.streams) > 0 ||
+		atomic.LoadInt64(&srv.stats.detached) > 0 {
+		return
+	}
+	for _, b := range lb.bulkheads {
+		if b.waiting.Len() > 0 {
+			return
+		}
+	}
+
+	log.CRPC_log(log.LOGLEVEL_INFO, "Server drained")
+	close(lb.drained)
+	lb.drained = nil
+}
+
+// Refuse all queued requests; used when shutting down.
+func (srv *Server) flushQueues(lb *balancer) {
+	for lb.request_queue.Len() > 0 {
+		srv.shed(lb, lb.request_queue.Pop().(*lbRequest))
+	}
+	for _, b := range lb.bulkheads {
+		for b.waiting.Len() > 0 {
+			srv.shed(lb, b.waiting.Pop().(*lbRequest))
+		}
+	}
+}
+
+// Refuse a queued request with STATUS_LOADSHED.
+func (srv *Server) shed(lb *balancer, rq *lbRequest) {
+	atomic.AddUint64(&srv.stats.loadshed, 1)
+
+	if rq.counted {
+		lb.release(rq.caller)
+	}
+	if rq.request.GetStreamId() != "" {
+		delete(lb.streams, streamKey(rq.message, rq.request))
+	}
+	srv.sendError(srv.frontend_router, rq.request, proto.RPCResponse_STATUS_LOADSHED,
+		&workerRequest{clientId: rq.message.clientId, requestId: rq.message.requestId, data: rq.message.payload})
+}
+
+// Keep track of the Context of a running handler, so that it can be canceled on shutdown.
+func (srv *Server) trackContext(cx *Context) {
+	srv.contexts_lock.Lock()
+	srv.contexts[cx] = true
+	srv.contexts_lock.Unlock()
+}
+
+func (srv *Server) untrackContext(cx *Context) {
+	srv.contexts_lock.Lock()
+	delete(srv.contexts, cx)
+	srv.contexts_lock.Unlock()
+}
+
+// Cancel the Contexts of all running handlers.
+func (srv *Server) cancelContexts() {
+	srv.contexts_lock.Lock()
+	defer srv.contexts_lock.Unlock()
+
+	for cx := range srv.contexts {
+		cx.cancel()
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/dermesser/clusterrpc/server/queue"
+)
+
+func newDrainingTestBalancer() *balancer {
+	lb := newTestBalancer()
+	lb.request_queue = queue.NewMultiQueue(1, 4)
+	lb.live_workers = make(map[string]bool)
+	lb.streams = make(map[string]*lbStream)
+	lb.drained = make(chan struct{})
+	return lb
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestCheckDrainedIdle(t *testing.T) {
+	srv := &Server{}
+	lb := newDrainingTestBalancer()
+	drained := lb.drained
+
+	srv.checkDrained(lb)
+
+	if !isClosed(drained) {
+		t.Error("Idle server wasn't drained")
+	}
+	if lb.drained != nil {
+		t.Error("drained channel wasn't reset")
+	}
+
+	// Must not close the channel twice.
+	srv.checkDrained(lb)
+}
+
+func TestCheckDrainedWaitsForRequests(t *testing.T) {
+	srv := &Server{}
+	lb := newDrainingTestBalancer()
+	drained := lb.drained
+
+	lb.request_queue.Push(0, "caller", &lbRequest{})
+	srv.checkDrained(lb)
+
+	if isClosed(drained) {
+		t.Fatal("Drained with queued request")
+	}
+
+	lb.request_queue.Pop()
+	lb.live_workers["worker1"] = true // busy: not in worker_queue
+	srv.checkDrained(lb)
+
+	if isClosed(drained) {
+		t.Fatal("Drained with busy worker")
+	}
+
+	lb.worker_queue.Push([]byte("worker1"))
+	srv.checkDrained(lb)
+
+	if !isClosed(drained) {
+		t.Error("Not drained after worker became idle")
+	}
+}
+
+func TestCheckDrainedWaitsForBulkheadsAndDetached(t *testing.T) {
+	srv := &Server{}
+	lb := newDrainingTestBalancer()
+	drained := lb.drained
+
+	b := lb.getBulkhead("Test.Limited", concurrencyLimit{max_concurrent: 1})
+	b.waiting.Push(&lbRequest{})
+	srv.checkDrained(lb)
+
+	if isClosed(drained) {
+		t.Fatal("Drained with request held back by bulkhead")
+	}
+
+	b.waiting.Pop()
+	srv.stats.detached = 1
+	srv.checkDrained(lb)
+
+	if isClosed(drained) {
+		t.Fatal("Drained with detached request")
+	}
+
+	srv.stats.detached = 0
+	srv.checkDrained(lb)
+
+	if !isClosed(drained) {
+		t.Error("Not drained")
+	}
+}
+
+func TestCheckDrainedWithoutShutdown(t *testing.T) {
+	lb := newDrainingTestBalancer()
+	lb.drained = nil
+
+	// Nothing to signal; must not panic.
+	(&Server{}).checkDrained(lb)
+}
+
+func TestCancelContexts(t *testing.T) {
+	srv := &Server{contexts: make(map[*Context]bool)}
+	running, finished := newMetadataTestContext(nil), newMetadataTestContext(nil)
+
+	srv.trackContext(running)
+	srv.trackContext(finished)
+	srv.untrackContext(finished)
+
+	srv.cancelContexts()
+
+	if !running.Canceled() {
+		t.Error("Running Context wasn't canceled")
+	}
+	if finished.Canceled() {
+		t.Error("Untracked Context was canceled")
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of a server's counters, as returned by GetStats().
+type Stats struct {
+	// Number of worker threads (see SetWorkers()), and how many of them are handling a request
+	Workers     uint
+	BusyWorkers int
+	// Number of requests waiting for a free worker
+	QueueLength int
+	// Requests received by the load balancer
+	Received uint64
+	// Requests that were handed to a handler
+	Processed uint64
+	// Requests refused because of loadshed mode
+	Loadshed uint64
+	// Requests refused because the queue was full
+	Overloaded uint64
+	// Requests that had to wait in the queue for a worker, and their total waiting time
+	Queued    uint64
+	QueueWait time.Duration
+	// Requests discarded because the caller's deadline passed before they could be dispatched
+	Expired uint64
+
+	// Overload control (see SetOverloadControl()): Whether it currently sheds load, the
+	// minimum queueing delay in the current interval, and the number of requests refused or dropped
+	OverloadControl bool
+	MinQueueDelay   time.Duration
+	Shed            uint64
+
+	// Requests refused because their caller exceeded its quota (see SetQuota())
+	QuotaExceeded uint64
+	// Handlers that panicked, and that exceeded their timeout (see HandlerTimeout())
+	Panics   uint64
+	TimedOut uint64
+	// Requests whose handler has detached, waiting for their response (see Context.Detach())
+	Detached int64
+}
+
+/*
+Counters updated by the load balancer and the workers. All accesses must be atomic. The 64-bit
+counters come first, so that they are 8-byte aligned on 32-bit platforms (serverStats is the
+first field of Server).
+*/
+type serverStats struct {
+	workers      int64
+	busy_workers int64
+	queue_length int64
+	received     uint64
+	processed    uint64
+	loadshed     uint64
+	overloaded   uint64
+	queued       uint64
+	queue_wait   int64 // ns
+	expired      uint64
+
+	min_queue_delay int64 // ns
+	shed            uint64
+	quota_exceeded  uint64
+	panics          uint64
+	timed_out       uint64
+	detached        int64
+
+	overload_control uint32 // 1 if shedding load
+}
+
+// GetStats returns a snapshot of the server's counters. Safe to call from any goroutine.
+func (srv *Server) GetStats() Stats {
+	return Stats{
+		Workers:     uint(atomic.LoadInt64(&srv.stats.workers)),
+		BusyWorkers: int(atomic.LoadInt64(&srv.stats.busy_workers)),
+		QueueLength: int(atomic.LoadInt64(&srv.stats.queue_length)),
+		Received:    atomic.LoadUint64(&srv.stats.received),
+		Processed:   atomic.LoadUint64(&srv.stats.processed),
+		Loadshed:    atomic.LoadUint64(&srv.stats.loadshed),
+		Overloaded:  atomic.LoadUint64(&srv.stats.overloaded),
+		Queued:      atomic.LoadUint64(&srv.stats.queued),
+		QueueWait:   time.Duration(atomic.LoadInt64(&srv.stats.queue_wait)),
+		Expired:     atomic.LoadUint64(&srv.stats.expired),
+
+		OverloadControl: atomic.LoadUint32(&srv.stats.overload_control) == 1,
+		MinQueueDelay:   time.Duration(atomic.LoadInt64(&srv.stats.min_queue_delay)),
+		Shed:            atomic.LoadUint64(&srv.stats.shed),
+
+		QuotaExceeded: atomic.LoadUint64(&srv.stats.quota_exceeded),
+		Panics:        atomic.LoadUint64(&srv.stats.panics),
+		TimedOut:      atomic.LoadUint64(&srv.stats.timed_out),
+		Detached:      atomic.LoadInt64(&srv.stats.detached),
+	}
+}
@@ -0,0 +1,387 @@
+package server
+
+/*
+* This file implements streaming RPCs, both in the load balancer and in the workers.
+*
+* A client opens a stream by sending a request with a stream ID and an initial credit (the
+* number of responses it is willing to buffer). The load balancer dispatches the request
+* like any other, but keeps the worker bound to the stream. Every response sent through a
+* ServerStream is forwarded to the client; the worker then waits for an ack from the load
+* balancer, which is only sent while the stream has credit left. Clients grant more credit
+* by sending control messages with the same stream ID, marked as stream messages; those that
+* arrive after the stream has ended are dropped. The stream ends with the final
+* response, which is sent by the worker after the handler returns.
+*
+* Messages sent by the client on a stream (client-streaming and bidi endpoints) are buffered
+* by the load balancer until the worker asks for one with MAGIC_STREAM_RECV. The client may
+* have at most DEFAULT_STREAM_WINDOW unconsumed messages in flight; the load balancer grants
+* new credit as the worker consumes them. After a half-close, the worker receives
+* MAGIC_STREAM_EOF once all messages are consumed. A client canceling the stream causes
+* MAGIC_STREAM_CANCEL to be sent to the worker at its next stream operation.
+ */
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	"github.com/dermesser/clusterrpc/proto"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/gogo/protobuf/proto"
+	zmq "github.com/pebbe/zmq4"
+)
+
+// Sent by the load balancer to a worker that may send the next stream response.
+var MAGIC_STREAM_ACK []byte = []byte("___StReAmAcK___")
+
+// Sent by the load balancer to a worker whose stream was abandoned.
+var MAGIC_STREAM_CANCEL []byte = []byte("___StReAmCaNcEl___")
+
+// Sent by a worker that waits for the next message from the client.
+var MAGIC_STREAM_RECV []byte = []byte("___StReAmReCv___")
+
+// Sent by the load balancer to a worker when the client won't send further messages.
+var MAGIC_STREAM_EOF []byte = []byte("___StReAmEoF___")
+
+// Number of responses a client may receive before granting new credit, if it doesn't specify one.
+// Also the number of messages a client may send before the server grants new credit.
+const DEFAULT_STREAM_WINDOW uint32 = 16
+
+// A stream whose client doesn't grant new credit or send a message the worker waits for within
+// this time is canceled.
+const STREAM_CREDIT_TIMEOUT time.Duration = 30 * time.Second
+
+// Returned by ServerStream.Send() and Recv() after the stream was canceled.
+var ErrStreamCanceled = errors.New("Stream canceled")
+
+// State of a stream in the load balancer.
+type lbStream struct {
+	// Identifies the client, for sending credit
+	client clientMessage
+	credit uint32
+	// nil while the opening request is queued
+	worker []byte
+	// Whether the worker waits for an ack (blocked) or a message (receiving), and since when
+	blocked       bool
+	receiving     bool
+	blocked_since time.Time
+	canceled      bool
+
+	// Messages from the client (serialized RPCRequests) not yet consumed by the worker
+	inbox       [][]byte
+	half_closed bool
+	// Messages consumed since the client was last granted credit
+	consumed uint32
+}
+
+// Streams are identified by the client's identity and the stream ID chosen by the client.
+func streamKey(message clientMessage, request *proto.RPCRequest) string {
+	return string(message.requestId) + "/" + request.GetStreamId()
+}
+
+// Register a stream if rq opens one.
+func (lb *balancer) openStream(rq *lbRequest) {
+	if rq.request.GetStreamId() == "" {
+		return
+	}
+
+	credit := rq.request.GetStreamCredit()
+	if credit == 0 {
+		credit = DEFAULT_STREAM_WINDOW
+	}
+	lb.streams[streamKey(rq.message, rq.request)] = &lbStream{client: rq.message, credit: credit}
+}
+
+// Handle a message from the client of an open stream: credit, data, half-close or cancellation.
+func (srv *Server) handleStreamMessage(stream *lbStream, message clientMessage, request *proto.RPCRequest) {
+	if request.GetStreamCancel() {
+		srv.cancelStream(stream)
+		return
+	}
+
+	if request.GetStreamCredit() > 0 {
+		stream.credit += request.GetStreamCredit()
+
+		if stream.blocked && stream.credit > 0 {
+			stream.blocked = false
+			srv.sendToWorker(stream.worker, MAGIC_STREAM_ACK)
+		}
+	} else if request.GetStreamHalfClose() {
+		stream.half_closed = true
+	} else if stream.half_closed || uint32(len(stream.inbox)) >= DEFAULT_STREAM_WINDOW {
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Dropping stream message exceeding credit or after half-close:", request.GetStreamId())
+	} else {
+		stream.inbox = append(stream.inbox, message.payload)
+	}
+
+	srv.deliverStreamMessage(stream)
+}
+
+// Send the next message from the client to the worker, if it waits for one and there is one.
+func (srv *Server) deliverStreamMessage(stream *lbStream) {
+	if !stream.receiving {
+		return
+	}
+
+	if len(stream.inbox) > 0 {
+		stream.receiving = false
+		srv.sendToWorker(stream.worker, stream.inbox[0])
+		stream.inbox = stream.inbox[1:]
+		stream.consumed++
+
+		// Grant new credit when half of the window is used up
+		if stream.consumed >= (DEFAULT_STREAM_WINDOW+1)/2 {
+			srv.grantStreamCredit(stream, stream.consumed)
+			stream.consumed = 0
+		}
+	} else if stream.half_closed {
+		stream.receiving = false
+		srv.sendToWorker(stream.worker, MAGIC_STREAM_EOF)
+	}
+}
+
+// Allow the client to send n more messages on the stream.
+func (srv *Server) grantStreamCredit(stream *lbStream, n uint32) {
+	response := new(proto.RPCResponse)
+	response.ResponseStatus = proto.RPCResponse_STATUS_OK.Enum()
+	response.StreamMore = pb.Bool(true)
+	response.StreamCredit = pb.Uint32(n)
+
+	buf, err := response.Marshal()
+
+	if err != nil {
+		return
+	}
+
+	srv.forwardResponse(newBackendMessage(stream.worker,
+		newClientMessage(stream.client.requestId, stream.client.clientId, buf)))
+}
+
+// Mark a stream as canceled; if its worker waits for the load balancer, it is told so immediately.
+func (srv *Server) cancelStream(stream *lbStream) {
+	stream.canceled = true
+
+	if stream.blocked || stream.receiving {
+		stream.blocked = false
+		stream.receiving = false
+		srv.sendToWorker(stream.worker, MAGIC_STREAM_CANCEL)
+	}
+}
+
+/*
+Handle a message from a worker if it is serving a stream. Returns true if the message was a
+stream response that is not the final one, i.e. the worker is still busy. Otherwise (final
+response) the stream is closed and the message has to be handled like a normal response.
+*/
+func (srv *Server) handleStreamResponse(lb *balancer, message backendMessage) bool {
+	key, ok := lb.worker_streams[string(message.workerId)]
+
+	if !ok {
+		return false
+	}
+
+	stream := lb.streams[key]
+
+	if bytes.Equal(message.message.payload, MAGIC_STREAM_RECV) {
+		if stream.canceled {
+			srv.sendToWorker(message.workerId, MAGIC_STREAM_CANCEL)
+		} else {
+			stream.receiving = true
+			stream.blocked_since = time.Now()
+			srv.deliverStreamMessage(stream)
+		}
+		return true
+	}
+
+	response := new(proto.RPCResponse)
+	err := response.Unmarshal(message.message.payload)
+
+	if err != nil || !response.GetStreamMore() {
+		delete(lb.worker_streams, string(message.workerId))
+		delete(lb.streams, key)
+		return false
+	}
+
+	if stream.canceled {
+		srv.sendToWorker(message.workerId, MAGIC_STREAM_CANCEL)
+		return true
+	}
+
+	srv.forwardResponse(message)
+
+	if stream.credit > 0 {
+		stream.credit--
+	}
+
+	if stream.credit > 0 {
+		srv.sendToWorker(message.workerId, MAGIC_STREAM_ACK)
+	} else {
+		stream.blocked = true
+		stream.blocked_since = time.Now()
+	}
+	return true
+}
+
+// Cancel streams whose clients didn't grant credit or send messages for too long; probably they're gone.
+func (srv *Server) expireStreams(lb *balancer) {
+	for key, stream := range lb.streams {
+		if (stream.blocked || stream.receiving) && time.Now().Sub(stream.blocked_since) > STREAM_CREDIT_TIMEOUT {
+			log.CRPC_log(log.LOGLEVEL_WARNINGS, "Canceling stalled stream:", fmt.Sprintf("%x", key))
+			srv.cancelStream(stream)
+		}
+	}
+}
+
+// Send a control message to a worker that waits for one.
+func (srv *Server) sendToWorker(worker_id []byte, payload []byte) {
+	_, err := srv.backend_router.SendMessage(newBackendMessage(worker_id,
+		newClientMessage([]byte("__BOGUS_REQ_ID"), []byte("___BOGUS_clientId"), payload)).serializeBackendMessage())
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, "Error when sending to backend router:", err.Error())
+	}
+}
+
+/*
+A ServerStream is passed to a StreamHandler for sending responses and receiving messages
+from the client. It must only be used by the handler's goroutine, and not after the handler
+has returned.
+*/
+type ServerStream struct {
+	sock    *zmq.Socket
+	request *workerRequest
+	rpc_id  string
+	// What the endpoint is registered for
+	sends, receives bool
+
+	seq uint64
+	// Set when the stream is canceled (1); accessed atomically, as the watchdog cancels the
+	// streams of handlers that have run for too long (see Server.abandonStream()).
+	canceled int32
+	// Held during socket operations, so that the watchdog can wait for them to finish.
+	lock sync.Mutex
+}
+
+/*
+Send a response to the client. Blocks while the client doesn't accept more responses (flow
+control). Returns ErrStreamCanceled if the client has gone away; the handler should then
+return.
+*/
+func (s *ServerStream) Send(data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.isCanceled() {
+		return ErrStreamCanceled
+	}
+	if !s.sends {
+		return errors.New("Client-streaming endpoints can't send stream responses")
+	}
+
+	response := new(proto.RPCResponse)
+	response.RpcId = pb.String(s.rpc_id)
+	response.ResponseStatus = proto.RPCResponse_STATUS_OK.Enum()
+	response.ResponseData = data
+	response.StreamSeq = pb.Uint64(s.seq)
+	response.StreamMore = pb.Bool(true)
+
+	buf, err := response.Marshal()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.sock.SendMessage(newClientMessage(s.request.requestId, s.request.clientId, buf).serializeClientMessage())
+
+	if err != nil {
+		return err
+	}
+	s.seq++
+
+	// Wait for the load balancer to let us continue.
+	msgs, err := s.sock.RecvMessageBytes(0)
+
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(parseClientMessage(msgs).payload, MAGIC_STREAM_ACK) {
+		atomic.StoreInt32(&s.canceled, 1)
+		return ErrStreamCanceled
+	}
+	return nil
+}
+
+// Send a serialized protocol buffer to the client.
+func (s *ServerStream) SendProto(msg pb.Message) error {
+	buf, err := pb.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+	return s.Send(buf)
+}
+
+/*
+Receive the next message sent by the client. Blocks until one is available. Returns io.EOF
+after the client has half-closed the stream and all its messages were received, and
+ErrStreamCanceled if the client has gone away.
+*/
+func (s *ServerStream) Recv() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.isCanceled() {
+		return nil, ErrStreamCanceled
+	}
+	if !s.receives {
+		return nil, errors.New("Server-streaming endpoints don't receive stream messages")
+	}
+
+	_, err := s.sock.SendMessage(newClientMessage(s.request.requestId, s.request.clientId, MAGIC_STREAM_RECV).serializeClientMessage())
+
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := s.sock.RecvMessageBytes(0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	payload := parseClientMessage(msgs).payload
+
+	if bytes.Equal(payload, MAGIC_STREAM_EOF) {
+		return nil, io.EOF
+	} else if bytes.Equal(payload, MAGIC_STREAM_CANCEL) {
+		atomic.StoreInt32(&s.canceled, 1)
+		return nil, ErrStreamCanceled
+	}
+
+	request := new(proto.RPCRequest)
+	err = request.Unmarshal(payload)
+
+	if err != nil {
+		return nil, err
+	}
+	return request.GetData(), nil
+}
+
+func (s *ServerStream) isCanceled() bool {
+	return atomic.LoadInt32(&s.canceled) == 1
+}
+
+// Receive the next message from the client and unmarshal it into msg.
+func (s *ServerStream) RecvProto(msg pb.Message) error {
+	data, err := s.Recv()
+
+	if err != nil {
+		return err
+	}
+	return pb.Unmarshal(data, msg)
+}
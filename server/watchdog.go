@@ -0,0 +1,178 @@
+package server
+
+/*
+* The watchdog enforces the timeouts configured for endpoints (see HandlerTimeout()): A handler
+* with a timeout runs in a goroutine of its own while the worker waits for it. If it takes too
+* long, the worker answers with STATUS_TIMEOUT, cancels the handler's Context and goes on
+* with the next request; the handler's result is discarded once it returns. A streaming
+* handler's stream is canceled by the load balancer first, which wakes up the handler if it
+* is blocked in Send() or Recv().
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+/*
+Limit the time a handler of this endpoint may run. The client receives STATUS_TIMEOUT if
+the handler hasn't returned by then. Go can't stop the handler, so it keeps running until it
+returns, but it doesn't count against concurrency limits (see MaxConcurrent()) and the
+caller's quota anymore.
+*/
+func HandlerTimeout(d time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.timeout = d
+	}
+}
+
+// Limit the time handlers of this endpoint's service may run. A timeout set for an endpoint
+// with HandlerTimeout() takes precedence.
+func ServiceTimeout(d time.Duration) HandlerOption {
+	return func(o *handlerOptions) {
+		o.service_timeout = d
+	}
+}
+
+// Returns the timeout for handling a request to ep of service, or 0.
+func (srv *Server) handlerTimeout(service string, ep *registeredEndpoint) time.Duration {
+	if ep.timeout > 0 {
+		return ep.timeout
+	}
+	if svc, ok := srv.services()[service]; ok {
+		return svc.timeout
+	}
+	return 0
+}
+
+/*
+Invoke the handler, giving up after timeout (if > 0). Returns whether the handler returned
+normally, and whether it timed out. In the latter case, the handler may still be running,
+and neither cx nor stream must be used anymore by the caller, except for answering with
+STATUS_TIMEOUT. If the handler has detached cx and already responded, it counts as returned.
+*/
+func (srv *Server) runHandler(ep *registeredEndpoint, cx *Context, stream *ServerStream, timeout time.Duration) (ok, timed_out bool) {
+	if timeout <= 0 {
+		return srv.callHandler(ep, cx, stream), false
+	}
+
+	done := make(chan bool, 1)
+	goroutine := make(chan uint64, 1)
+
+	go func() {
+		goroutine <- goroutineId()
+		done <- srv.callHandler(ep, cx, stream)
+	}()
+
+	id := <-goroutine
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case ok = <-done:
+		return ok, false
+	case <-timer.C:
+	}
+
+	// Take the socket back from a streaming handler.
+	if stream != nil {
+		srv.abandonStream(stream)
+	}
+
+	// It may have returned in the meantime.
+	select {
+	case ok = <-done:
+		return ok, false
+	default:
+	}
+
+	// A detached Context may have been answered already; then there is nothing left to do for
+	// the worker.
+	if !cx.timeOut() {
+		return true, false
+	}
+
+	atomic.AddUint64(&srv.stats.timed_out, 1)
+
+	log.CRPC_log(log.LOGLEVEL_ERRORS, fmt.Sprintf("[_/%s/%s] Handler %s.%s exceeded its timeout of %v and was abandoned:\n%s",
+		cx.orig_rq.GetCallerId(), cx.orig_rq.GetRpcId(), cx.orig_rq.GetSrvc(), cx.orig_rq.GetProcedure(),
+		timeout, goroutineStack(id)))
+
+	cx.cancel()
+	return false, true
+}
+
+/*
+Stop a streaming handler from using the worker's socket: Further calls of Send() and Recv()
+fail with ErrStreamCanceled. A call blocked waiting for the load balancer (for credit or for a
+message from the client) is woken up by the load balancer canceling the stream; returns once
+it has returned.
+*/
+func (srv *Server) abandonStream(s *ServerStream) {
+	atomic.StoreInt32(&s.canceled, 1)
+
+	// Wait for the command to be executed, so that it can't affect the next stream of this worker.
+	worker_id := s.request.workerId
+	err := srv.onBalancer(func(lb *balancer) error {
+		if lb == nil {
+			return nil
+		}
+		if key, ok := lb.worker_streams[worker_id]; ok {
+			srv.cancelStream(lb.streams[key])
+		}
+		return nil
+	})
+
+	if err != nil {
+		// The load balancer stops the worker, which wakes up the handler as well.
+		log.CRPC_log(log.LOGLEVEL_WARNINGS, "Could not cancel stream of worker", worker_id, ":", err.Error())
+	}
+
+	s.lock.Lock()
+	s.lock.Unlock()
+}
+
+// Returns the ID of the calling goroutine, as printed in stack traces.
+func goroutineId() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	// "goroutine 123 [running]:..."
+	fields := bytes.Fields(buf)
+
+	if len(fields) < 2 {
+		return 0
+	}
+
+	id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+	return id
+}
+
+// Returns the stack trace of the goroutine with the given ID, or a note if it has exited.
+func goroutineStack(id uint64) []byte {
+	buf := make([]byte, 1<<16)
+
+	for {
+		n := runtime.Stack(buf, true)
+
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	prefix := []byte(fmt.Sprintf("goroutine %d [", id))
+
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(stack, prefix) {
+			return stack
+		}
+	}
+	return []byte("(goroutine has exited)")
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dermesser/clusterrpc/proto"
+
+	pb "github.com/gogo/protobuf/proto"
+)
+
+func newWatchdogTestContext(srv *Server) *Context {
+	return srv.newContext(&proto.RPCRequest{Srvc: pb.String("Test"), Procedure: pb.String("Slow")}, nil)
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	srv := &Server{}
+	returned := make(chan bool)
+
+	slow := &registeredEndpoint{handler: func(cx *Context) {
+		<-cx.Done()
+		close(returned)
+	}}
+	cx := newWatchdogTestContext(srv)
+
+	if ok, timed_out := srv.runHandler(slow, cx, nil, 10*time.Millisecond); ok || !timed_out {
+		t.Fatal("slow handler not timed out:", ok, timed_out)
+	}
+	if srv.stats.timed_out != 1 {
+		t.Error("timeout not counted:", srv.stats.timed_out)
+	}
+
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Context of the abandoned handler not canceled")
+	}
+
+	fast := &registeredEndpoint{handler: func(cx *Context) {
+		cx.Success([]byte("ok"))
+	}}
+
+	if ok, timed_out := srv.runHandler(fast, newWatchdogTestContext(srv), nil, time.Second); !ok || timed_out {
+		t.Fatal("fast handler failed:", ok, timed_out)
+	}
+}
+
+func blockedInWatchdogTest(block chan struct{}) {
+	<-block
+}
+
+func TestGoroutineStack(t *testing.T) {
+	block := make(chan struct{})
+	ids := make(chan uint64)
+
+	go func() {
+		ids <- goroutineId()
+		blockedInWatchdogTest(block)
+		ids <- 0
+	}()
+
+	id := <-ids
+
+	if id == 0 || id == goroutineId() {
+		t.Fatal("unexpected goroutine ID:", id)
+	}
+
+	stack := goroutineStack(id)
+
+	if !bytes.Contains(stack, []byte("blockedInWatchdogTest")) || bytes.Contains(stack, []byte("TestGoroutineStack(")) {
+		t.Error("unexpected stack:", string(stack))
+	}
+
+	close(block)
+	<-ids
+
+	// Wait for the goroutine to exit.
+	for i := 0; i < 100 && !bytes.Equal(goroutineStack(id), []byte("(goroutine has exited)")); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if stack := goroutineStack(id); !bytes.Equal(stack, []byte("(goroutine has exited)")) {
+		t.Error("stack of exited goroutine:", string(stack))
+	}
+}
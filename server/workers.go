@@ -0,0 +1,187 @@
+package server
+
+/*
+* This file implements resizing the worker pool at runtime. The load balancer keeps track of
+* the workers; new workers are started by it, and surplus workers are retired once they are
+* idle: A worker that is busy finishes its request (or stream) first, so that no request is lost.
+ */
+
+import (
+	"fmt"
+	"github.com/dermesser/clusterrpc/log"
+	"time"
+)
+
+// How often the autoscaler looks at the queue and the utilization of the workers
+const AUTOSCALE_INTERVAL time.Duration = time.Second
+
+// The autoscaler retires a worker if fewer than this fraction of workers were busy during an interval.
+const AUTOSCALE_LOW_UTILIZATION float64 = 0.5
+
+/*
+Change the number of workers. New workers are started immediately; surplus workers are
+stopped once they have finished the request they're working on. The change is applied
+asynchronously by the load balancer.
+
+If autoscaling is enabled (see SetAutoscaling()), n is limited to its bounds and the
+autoscaler may change the number of workers again later.
+*/
+func (srv *Server) SetWorkers(n uint) error {
+	if n <= 0 {
+		n = 1
+	}
+	return srv.sendCommand(func(lb *balancer) {
+		srv.resizeWorkers(lb, lb.autoscaleBounds(int(n)))
+	})
+}
+
+/*
+Let the number of workers follow the load, between min and max workers: Workers are added
+while requests are waiting in the queue (at most doubling their number per AUTOSCALE_INTERVAL),
+and retired one at a time while less than half of the workers are busy. max == 0 disables
+autoscaling.
+*/
+func (srv *Server) SetAutoscaling(min, max uint) error {
+	if min <= 0 {
+		min = 1
+	}
+	if max > 0 && max < min {
+		max = min
+	}
+	return srv.sendCommand(func(lb *balancer) {
+		lb.autoscale_min, lb.autoscale_max = int(min), int(max)
+
+		if max > 0 {
+			srv.resizeWorkers(lb, lb.autoscaleBounds(lb.workers))
+		}
+	})
+}
+
+// Limit n to the bounds set with SetAutoscaling(), if autoscaling is enabled.
+func (lb *balancer) autoscaleBounds(n int) int {
+	if lb.autoscale_max <= 0 {
+		return n
+	}
+	if n < lb.autoscale_min {
+		return lb.autoscale_min
+	} else if n > lb.autoscale_max {
+		return lb.autoscale_max
+	}
+	return n
+}
+
+// Start or retire workers so that there are n workers (once busy workers to be retired are idle).
+func (srv *Server) resizeWorkers(lb *balancer, n int) {
+	if n == lb.workers {
+		return
+	}
+
+	log.CRPC_log(log.LOGLEVEL_INFO, "Changing number of workers from", lb.workers, "to", n)
+
+	// Cancel pending retirements first.
+	for ; lb.workers < n && lb.retiring > 0; lb.retiring-- {
+		lb.workers++
+	}
+
+	for lb.workers < n {
+		id := lb.next_worker
+		lb.next_worker++
+
+		if err := srv.thread(id, true); err != nil {
+			log.CRPC_log(log.LOGLEVEL_ERRORS, "Could not start worker", id, ":", err.Error())
+			break
+		}
+		lb.workers++
+	}
+
+	for lb.workers > n {
+		lb.workers--
+
+		if worker_id, ok := lb.worker_queue.Pop().([]byte); ok {
+			srv.retireWorker(lb, worker_id)
+		} else {
+			lb.retiring++
+		}
+	}
+
+	lb.worker_queue.Grow(lb.workers + lb.retiring)
+	lb.request_queue.SetCapacity(lb.workers * int(OUTSTANDING_REQUESTS_PER_THREAD))
+}
+
+// Called when a worker is ready for a new request. The worker is queued, unless it is to be retired.
+func (srv *Server) workerAvailable(lb *balancer, worker_id []byte) {
+	if lb.retiring > 0 {
+		lb.retiring--
+		srv.retireWorker(lb, worker_id)
+		return
+	}
+	lb.worker_queue.Push(worker_id)
+}
+
+// Stop an idle worker.
+func (srv *Server) retireWorker(lb *balancer, worker_id []byte) {
+	delete(lb.live_workers, string(worker_id))
+
+	if srv.stopWorker(worker_id) == nil {
+		log.CRPC_log(log.LOGLEVEL_DEBUG, "Retired worker", string(worker_id))
+	}
+}
+
+// Adjust the number of workers to the load, if autoscaling is enabled. Called regularly by the load balancer.
+func (srv *Server) autoscale(lb *balancer) {
+	if lb.autoscale_max <= 0 || time.Now().Sub(lb.last_autoscale) < AUTOSCALE_INTERVAL {
+		return
+	}
+
+	srv.resizeWorkers(lb, lb.autoscaleBounds(autoscaleTarget(lb.workers, lb.request_queue.Len(), lb.peak_busy)))
+
+	lb.last_autoscale = time.Now()
+	lb.peak_busy = lb.busyWorkers()
+}
+
+/*
+Returns the number of workers the autoscaler aims for: While requests are queued, one worker is
+added per queued request, but at most as many as there are already (so that a burst doesn't
+start a flood of workers at once). Otherwise, a worker is retired if utilization was low.
+*/
+func autoscaleTarget(workers, queued, peak_busy int) int {
+	if queued > 0 {
+		if queued > workers {
+			queued = workers
+		}
+		return workers + queued
+	} else if float64(peak_busy) < AUTOSCALE_LOW_UTILIZATION*float64(workers) {
+		return workers - 1
+	}
+	return workers
+}
+
+// Number of workers currently handling a request.
+func (lb *balancer) busyWorkers() int {
+	return len(lb.live_workers) - lb.worker_queue.Len()
+}
+
+// Record the utilization for the autoscaler after dispatching a request.
+func (lb *balancer) recordBusy() {
+	if busy := lb.busyWorkers(); busy > lb.peak_busy {
+		lb.peak_busy = busy
+	}
+}
+
+// Stop all workers; called when the load balancer stops.
+func (srv *Server) stopWorkers(lb *balancer) {
+	for worker_id := range lb.live_workers {
+		srv.stopWorker([]byte(worker_id))
+	}
+}
+
+// Send the stop message to a worker. A busy worker stops after finishing its request.
+func (srv *Server) stopWorker(worker_id []byte) error {
+	_, err := srv.backend_router.SendMessage(newBackendMessage(worker_id,
+		newClientMessage([]byte("BOGUS_RQID"), []byte{0xde, 0xad, 0xde, 0xad}, MAGIC_STOP_STRING)).serializeBackendMessage())
+
+	if err != nil {
+		log.CRPC_log(log.LOGLEVEL_ERRORS, fmt.Sprintf("Could not stop worker %s: %s", worker_id, err.Error()))
+	}
+	return err
+}
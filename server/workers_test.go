@@ -0,0 +1,33 @@
+package server
+
+import "testing"
+
+func TestAutoscaleTarget(t *testing.T) {
+	cases := []struct{ workers, queued, peak_busy, target int }{
+		{4, 2, 4, 6},
+		{4, 100, 4, 8}, // at most doubled
+		{4, 0, 4, 4},
+		{4, 0, 1, 3}, // low utilization
+		{4, 0, 2, 4},
+	}
+
+	for _, c := range cases {
+		if n := autoscaleTarget(c.workers, c.queued, c.peak_busy); n != c.target {
+			t.Error("autoscaleTarget", c.workers, c.queued, c.peak_busy, "=", n, "instead of", c.target)
+		}
+	}
+}
+
+func TestAutoscaleBounds(t *testing.T) {
+	lb := &balancer{}
+
+	if lb.autoscaleBounds(100) != 100 {
+		t.Error("bounds applied with autoscaling disabled")
+	}
+
+	lb.autoscale_min, lb.autoscale_max = 2, 8
+
+	if lb.autoscaleBounds(1) != 2 || lb.autoscaleBounds(16) != 8 || lb.autoscaleBounds(5) != 5 {
+		t.Error("bounds not applied:", lb.autoscaleBounds(1), lb.autoscaleBounds(16), lb.autoscaleBounds(5))
+	}
+}